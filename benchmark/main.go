@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiweiyu/redisByGo/service"
+)
+
+// The benchmark starts the server in process and runs every test once per
+// GOMAXPROCS value, so the table shows how throughput scales with cores.
+// Keys are picked at random from the keyspace, spreading the load over the
+// keyspace shards.
+
+type benchTest struct {
+	name string
+	args func(r *rand.Rand) []string
+}
+
+var keyspace int
+
+func randKey(r *rand.Rand, prefix string) string {
+	return prefix + strconv.Itoa(r.Intn(keyspace))
+}
+
+var benchTests = []benchTest{
+	{"set", func(r *rand.Rand) []string { return []string{"SET", randKey(r, "key:"), "xxx"} }},
+	{"get", func(r *rand.Rand) []string { return []string{"GET", randKey(r, "key:")} }},
+	{"incr", func(r *rand.Rand) []string { return []string{"INCR", randKey(r, "counter:")} }},
+	{"lpush", func(r *rand.Rand) []string { return []string{"LPUSH", randKey(r, "list:"), "xxx"} }},
+	{"lrange", func(r *rand.Rand) []string { return []string{"LRANGE", randKey(r, "list:"), "0", "99"} }},
+	{"sadd", func(r *rand.Rand) []string {
+		return []string{"SADD", randKey(r, "set:"), strconv.Itoa(r.Intn(100))}
+	}},
+	{"sunion", func(r *rand.Rand) []string { return []string{"SUNION", randKey(r, "set:"), randKey(r, "set:")} }},
+	{"mset", func(r *rand.Rand) []string {
+		args := []string{"MSET"}
+		for i := 0; i < 10; i++ {
+			args = append(args, randKey(r, "key:"), "xxx")
+		}
+		return args
+	}},
+}
+
+func main() {
+	clients := flag.Int("c", 50, "number of parallel connections")
+	requests := flag.Int("n", 200000, "total number of requests per test")
+	pipeline := flag.Int("P", 1, "number of requests pipelined per round trip")
+	procs := flag.String("procs", "", "comma separated GOMAXPROCS values, defaults to powers of two up to the number of CPUs")
+	tests := flag.String("t", "", "comma separated tests to run, defaults to all")
+	flag.IntVar(&keyspace, "r", 100000, "number of distinct keys per test")
+	flag.Parse()
+
+	procsList, err := parseProcs(*procs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	selected := selectTests(*tests)
+	if len(selected) == 0 {
+		fmt.Fprintln(os.Stderr, "no test selected")
+		os.Exit(1)
+	}
+
+	srv := service.NewServer(service.Options{Addr: "127.0.0.1:0", Config: map[string]string{"protected-mode": "no"}})
+	if err := srv.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error starting the server:", err.Error())
+		os.Exit(1)
+	}
+	defer srv.Close()
+
+	fmt.Printf("%d clients, %d requests per test, pipeline %d, %d CPUs\n\n", *clients, *requests, *pipeline, runtime.NumCPU())
+	fmt.Printf("%-8s", "procs")
+	for _, test := range selected {
+		fmt.Printf("%12s", test.name)
+	}
+	fmt.Println()
+	for _, n := range procsList {
+		runtime.GOMAXPROCS(n)
+		fmt.Printf("%-8d", n)
+		for _, test := range selected {
+			opsPerSec, err := runTest(srv.Addr(), test, *clients, *requests, *pipeline)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "\n"+test.name+":", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("%12.0f", opsPerSec)
+		}
+		fmt.Println()
+	}
+}
+
+func parseProcs(value string) ([]int, error) {
+	var list []int
+	if value == "" {
+		for n := 1; n < runtime.NumCPU(); n *= 2 {
+			list = append(list, n)
+		}
+		return append(list, runtime.NumCPU()), nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || n < 1 {
+			return nil, errors.New("invalid procs value: " + item)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func selectTests(value string) []benchTest {
+	if value == "" {
+		return benchTests
+	}
+	var selected []benchTest
+	for _, name := range strings.Split(strings.ToLower(value), ",") {
+		for _, test := range benchTests {
+			if test.name == strings.TrimSpace(name) {
+				selected = append(selected, test)
+			}
+		}
+	}
+	return selected
+}
+
+func runTest(addr string, test benchTest, clients, requests, pipeline int) (float64, error) {
+	conns := make([]net.Conn, clients)
+	for i := range conns {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	start := time.Now()
+	for i, conn := range conns {
+		count := requests / clients
+		if i < requests%clients {
+			count++
+		}
+		wg.Add(1)
+		go func(conn net.Conn, count int, seed int64) {
+			defer wg.Done()
+			if err := runClient(conn, test, count, pipeline, rand.New(rand.NewSource(seed))); err != nil {
+				errs <- err
+			}
+		}(conn, count, int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	select {
+	case err := <-errs:
+		return 0, err
+	default:
+	}
+	return float64(requests) / elapsed.Seconds(), nil
+}
+
+func runClient(conn net.Conn, test benchTest, count, pipeline int, r *rand.Rand) error {
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for count > 0 {
+		batch := pipeline
+		if batch > count {
+			batch = count
+		}
+		for i := 0; i < batch; i++ {
+			writeCommand(writer, test.args(r))
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		for i := 0; i < batch; i++ {
+			if err := readReply(reader); err != nil {
+				return err
+			}
+		}
+		count -= batch
+	}
+	return nil
+}
+
+func writeCommand(writer *bufio.Writer, args []string) {
+	writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+}
+
+func readReply(reader *bufio.Reader) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = reader.Discard(n + 2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := readReply(reader); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("unexpected reply: " + line)
+}
@@ -0,0 +1,817 @@
+package core
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type aclUser struct {
+	name            string
+	enabled         bool
+	noPass          bool
+	passwords       []string
+	commands        map[string]bool
+	allCommands     bool
+	commandRules    []string
+	allKeys         bool
+	keyPatterns     []string
+	allChannels     bool
+	channelPatterns []string
+}
+
+type aclLogEntry struct {
+	count      int
+	reason     string
+	context    string
+	object     string
+	username   string
+	createTime time.Time
+	clientInfo string
+}
+
+var aclCategories = []struct {
+	name string
+	flag int
+}{
+	{"keyspace", cmdCatKeyspace},
+	{"read", cmdRead},
+	{"write", cmdWrite},
+	{"set", cmdCatSet},
+	{"sortedset", cmdCatSortedSet},
+	{"list", cmdCatList},
+	{"hash", cmdCatHash},
+	{"string", cmdCatString},
+	{"bitmap", cmdCatBitmap},
+	{"admin", cmdAdmin},
+	{"fast", cmdFast},
+	{"slow", 0},
+	{"dangerous", cmdDangerous},
+	{"connection", cmdCatConnection},
+	{"transaction", cmdCatTransaction},
+	{"pubsub", cmdCatPubSub},
+	{"blocking", cmdCatBlocking},
+}
+
+// aclCommandTable is commandMap, assigned in init because the ACL handlers
+// are registered in commandMap themselves.
+var aclCommandTable map[string]cmdHandler
+var aclUsers = make(map[string]*aclUser)
+var aclLock sync.RWMutex
+var aclLogEntries []*aclLogEntry
+var aclLogLock sync.Mutex
+
+func init() {
+	aclCommandTable = commandMap
+	aclUsers["default"] = newDefaultUser()
+	configApplyHooks["requirepass"] = applyRequirePass
+}
+
+func newAclUser(name string) *aclUser {
+	user := new(aclUser)
+	user.name = name
+	user.commands = make(map[string]bool)
+	user.allChannels = true
+	return user
+}
+
+func newDefaultUser() *aclUser {
+	user := newAclUser("default")
+	for _, rule := range []string{"on", "nopass", "~*", "&*", "+@all"} {
+		user.setRule(rule)
+	}
+	return user
+}
+
+func (this *aclUser) clone() *aclUser {
+	user := *this
+	user.passwords = append([]string(nil), this.passwords...)
+	user.commandRules = append([]string(nil), this.commandRules...)
+	user.keyPatterns = append([]string(nil), this.keyPatterns...)
+	user.channelPatterns = append([]string(nil), this.channelPatterns...)
+	user.commands = make(map[string]bool, len(this.commands))
+	for name, allowed := range this.commands {
+		user.commands[name] = allowed
+	}
+	return &user
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func validPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if (hash[i] < '0' || hash[i] > '9') && (hash[i] < 'a' || hash[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *aclUser) addPassword(hash string) {
+	this.noPass = false
+	for _, p := range this.passwords {
+		if p == hash {
+			return
+		}
+	}
+	this.passwords = append(this.passwords, hash)
+}
+
+func (this *aclUser) removePassword(hash string) error {
+	for i, p := range this.passwords {
+		if p == hash {
+			this.passwords = append(this.passwords[:i], this.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("The password you are trying to remove from the user does not exist")
+}
+
+func (this *aclUser) checkPassword(password string) bool {
+	if this.noPass {
+		return true
+	}
+	hash := hashPassword(password)
+	for _, p := range this.passwords {
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *aclUser) setCommands(rule string) error {
+	allow := rule[0] == '+'
+	name := strings.ToLower(rule[1:])
+	if strings.HasPrefix(name, "@") {
+		names, ok := aclCategoryCommands(name[1:])
+		if ok == false {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		for _, cmdName := range names {
+			this.commands[cmdName] = allow
+		}
+		if name == "@all" {
+			this.allCommands = allow
+			this.commandRules = []string{rule[:1] + name}
+			return nil
+		}
+	} else {
+		if _, ok := aclCommandTable[name]; ok == false {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		this.commands[name] = allow
+	}
+	if allow == false {
+		this.allCommands = false
+	}
+	this.commandRules = append(this.commandRules, rule[:1]+name)
+	return nil
+}
+
+func (this *aclUser) setRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		this.enabled = true
+		return nil
+	case "off":
+		this.enabled = false
+		return nil
+	case "nopass":
+		this.noPass = true
+		this.passwords = nil
+		return nil
+	case "resetpass":
+		this.noPass = false
+		this.passwords = nil
+		return nil
+	case "allkeys":
+		return this.setRule("~*")
+	case "resetkeys":
+		this.allKeys = false
+		this.keyPatterns = nil
+		return nil
+	case "allchannels":
+		return this.setRule("&*")
+	case "resetchannels":
+		this.allChannels = false
+		this.channelPatterns = nil
+		return nil
+	case "allcommands":
+		return this.setCommands("+@all")
+	case "nocommands":
+		return this.setCommands("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			this.setRule(r)
+		}
+		return nil
+	}
+	if rule == "" {
+		return errors.New("Syntax error")
+	}
+	switch rule[0] {
+	case '>':
+		this.addPassword(hashPassword(rule[1:]))
+	case '<':
+		return this.removePassword(hashPassword(rule[1:]))
+	case '#', '!':
+		hash := rule[1:]
+		if validPasswordHash(hash) == false {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if rule[0] == '!' {
+			return this.removePassword(hash)
+		}
+		this.addPassword(hash)
+	case '~':
+		if rule == "~*" {
+			this.allKeys = true
+			this.keyPatterns = nil
+		} else if this.allKeys {
+			return errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+		} else {
+			this.keyPatterns = append(this.keyPatterns, rule[1:])
+		}
+	case '&':
+		if rule == "&*" {
+			this.allChannels = true
+			this.channelPatterns = nil
+		} else if this.allChannels {
+			return errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+		} else {
+			this.channelPatterns = append(this.channelPatterns, rule[1:])
+		}
+	case '+', '-':
+		return this.setCommands(rule)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (this *aclUser) describeCommands() string {
+	if len(this.commandRules) > 0 && (this.commandRules[0] == "+@all" || this.commandRules[0] == "-@all") {
+		return strings.Join(this.commandRules, " ")
+	}
+	return strings.Join(append([]string{"-@all"}, this.commandRules...), " ")
+}
+
+func (this *aclUser) describe() string {
+	fields := []string{"user", this.name}
+	if this.enabled {
+		fields = append(fields, "on")
+	} else {
+		fields = append(fields, "off")
+	}
+	if this.noPass {
+		fields = append(fields, "nopass")
+	}
+	for _, hash := range this.passwords {
+		fields = append(fields, "#"+hash)
+	}
+	if this.allKeys {
+		fields = append(fields, "~*")
+	}
+	for _, pattern := range this.keyPatterns {
+		fields = append(fields, "~"+pattern)
+	}
+	if this.allChannels {
+		fields = append(fields, "&*")
+	} else {
+		fields = append(fields, "resetchannels")
+	}
+	for _, pattern := range this.channelPatterns {
+		fields = append(fields, "&"+pattern)
+	}
+	fields = append(fields, this.describeCommands())
+	return strings.Join(fields, " ")
+}
+
+func (this *aclUser) canAccessKey(key string) bool {
+	if this.allKeys {
+		return true
+	}
+	for _, pattern := range this.keyPatterns {
+		if stringMatch(pattern, key, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel matches a channel against the patterns of the user, a
+// pattern subscribed to has to be one of them literally.
+func (this *aclUser) canAccessChannel(channel string, literal bool) bool {
+	if this.allChannels {
+		return true
+	}
+	for _, pattern := range this.channelPatterns {
+		if (literal && pattern == channel) || (literal == false && stringMatch(pattern, channel, false)) {
+			return true
+		}
+	}
+	return false
+}
+
+func aclCategoryCommands(category string) ([]string, bool) {
+	var names []string
+	if category == "all" {
+		for name := range aclCommandTable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, true
+	}
+	for _, cat := range aclCategories {
+		if cat.name != category {
+			continue
+		}
+		for name, handler := range aclCommandTable {
+			if (cat.flag == 0 && handler.flags&cmdFast == 0) || handler.flags&cat.flag != 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, true
+	}
+	return nil, false
+}
+
+func aclSetUser(name string, rules ...string) error {
+	aclLock.Lock()
+	defer aclLock.Unlock()
+	user, ok := aclUsers[name]
+	if ok == false {
+		user = newAclUser(name)
+	}
+	tmp := user.clone()
+	for _, rule := range rules {
+		if err := tmp.setRule(rule); err != nil {
+			return errors.New("Error in ACL SETUSER modifier '" + rule + "': " + err.Error())
+		}
+	}
+	*user = *tmp
+	aclUsers[name] = user
+	return nil
+}
+
+func applyRequirePass(conf *config) error {
+	if conf.requirePass == "" {
+		return aclSetUser("default", "nopass")
+	}
+	return aclSetUser("default", "resetpass", ">"+conf.requirePass)
+}
+
+func aclDefaultUser() *aclUser {
+	aclLock.RLock()
+	defer aclLock.RUnlock()
+	return aclUsers["default"]
+}
+
+func defaultUserHasPassword() bool {
+	aclLock.RLock()
+	defer aclLock.RUnlock()
+	return aclUsers["default"].noPass == false
+}
+
+func LoadACL() error {
+	conf := currentConfig()
+	if conf.requirePass != "" {
+		if err := applyRequirePass(&conf); err != nil {
+			return err
+		}
+	}
+	if conf.aclFile == "" {
+		return nil
+	}
+	return loadAclFile(conf.aclFile)
+}
+
+func loadAclFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	users := make(map[string]*aclUser)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		args := strings.Fields(line)
+		var err error
+		if args[0] != "user" || len(args) < 2 {
+			err = errors.New("should start with user keyword followed by the username")
+		} else if _, ok := users[args[1]]; ok {
+			err = errors.New("duplicate user '" + args[1] + "' found")
+		} else {
+			user := newAclUser(args[1])
+			for _, rule := range args[2:] {
+				if err = user.setRule(rule); err != nil {
+					err = errors.New("'" + rule + "': " + err.Error())
+					break
+				}
+			}
+			users[user.name] = user
+		}
+		if err != nil {
+			return errors.New(path + ":" + strconv.Itoa(lineNum) + ": " + err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users["default"]; ok == false {
+		users["default"] = newDefaultUser()
+	}
+	aclLock.Lock()
+	var removed []*aclUser
+	for name, user := range aclUsers {
+		if loaded, ok := users[name]; ok {
+			*user = *loaded
+			users[name] = user
+		} else {
+			removed = append(removed, user)
+		}
+	}
+	aclUsers = users
+	aclLock.Unlock()
+	killUserClients(removed...)
+	return nil
+}
+
+func saveAclFile(path string) error {
+	aclLock.RLock()
+	names := aclUserNames()
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = aclUsers[name].describe() + "\n"
+	}
+	aclLock.RUnlock()
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(lines, "")), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func aclUserNames() []string {
+	names := make([]string, 0, len(aclUsers))
+	for name := range aclUsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func killUserClients(users ...*aclUser) {
+	if len(users) == 0 {
+		return
+	}
+	for _, c := range clientList() {
+		c.mu.Lock()
+		authUser := c.authUser
+		c.mu.Unlock()
+		for _, user := range users {
+			if authUser == user {
+				c.kill("user " + user.name + " was removed")
+				break
+			}
+		}
+	}
+}
+
+func aclAuthenticate(c *client, username, password string) bool {
+	aclLock.RLock()
+	user, ok := aclUsers[username]
+	ok = ok && user.enabled && user.checkPassword(password)
+	aclLock.RUnlock()
+	if ok == false {
+		aclAddLogEntry(c, "auth", "toplevel", "AUTH", username)
+		return false
+	}
+	c.mu.Lock()
+	c.authUser = user
+	c.mu.Unlock()
+	c.authenticated = true
+	return true
+}
+
+// aclAuthenticateClient picks the user of a new connection: the user named by
+// the TLS certificate if there is one, otherwise the default user, which only
+// counts as authenticated while it needs no password.
+func aclAuthenticateClient(c *client) {
+	aclLock.RLock()
+	defer aclLock.RUnlock()
+	user := aclUsers["default"]
+	c.authenticated = user.enabled && user.noPass
+	if certUser, ok := aclUsers[c.certUser]; ok && c.certUser != "" && certUser.enabled {
+		user = certUser
+		c.authenticated = true
+	}
+	c.mu.Lock()
+	c.authUser = user
+	c.mu.Unlock()
+}
+
+func isLocalClient(c *client) bool {
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || ip.IsLoopback()
+}
+
+func aclCheckCommand(c *client, name string, handler cmdHandler, params []string) *cmdResult {
+	if handler.flags&cmdNoAuth != 0 {
+		return nil
+	}
+	if c.authenticated == false {
+		return commandResErr("NOAUTH Authentication required.")
+	}
+	aclLock.RLock()
+	user := c.authUser
+	allowed := user.commands[name]
+	deniedKey := ""
+	if allowed && user.allKeys == false {
+		for _, key := range commandKeys(handler, params) {
+			if user.canAccessKey(key) == false {
+				deniedKey = key
+				break
+			}
+		}
+	}
+	aclLock.RUnlock()
+	if allowed == false {
+		aclAddLogEntry(c, "command", "toplevel", name, user.name)
+		return commandResErr("NOPERM this user has no permissions to run the '" + name + "' command or its subcommand")
+	}
+	if deniedKey != "" {
+		aclAddLogEntry(c, "key", "toplevel", deniedKey, user.name)
+		return commandResErr("NOPERM this user has no permissions to access one of the keys used as arguments")
+	}
+	return nil
+}
+
+func aclCheckChannels(c *client, channels []string, literal bool) *cmdResult {
+	aclLock.RLock()
+	user := c.authUser
+	deniedChannel := ""
+	for _, channel := range channels {
+		if user.canAccessChannel(channel, literal) == false {
+			deniedChannel = channel
+			break
+		}
+	}
+	aclLock.RUnlock()
+	if deniedChannel == "" {
+		return nil
+	}
+	aclAddLogEntry(c, "channel", "toplevel", deniedChannel, user.name)
+	return commandResErr("NOPERM this user has no permissions to access one of the channels used as arguments")
+}
+
+func aclAddLogEntry(c *client, reason, context, object, username string) {
+	maxLen := currentConfig().aclLogMaxLen
+	clientInfo := c.info()
+	aclLogLock.Lock()
+	defer aclLogLock.Unlock()
+	now := time.Now()
+	for _, entry := range aclLogEntries {
+		if entry.reason == reason && entry.context == context && entry.object == object &&
+			entry.username == username && now.Sub(entry.createTime) < time.Minute {
+			entry.count++
+			entry.createTime = now
+			entry.clientInfo = clientInfo
+			return
+		}
+	}
+	entry := &aclLogEntry{1, reason, context, object, username, now, clientInfo}
+	aclLogEntries = append([]*aclLogEntry{entry}, aclLogEntries...)
+	if len(aclLogEntries) > maxLen {
+		aclLogEntries = aclLogEntries[:maxLen]
+	}
+}
+
+func doAuth(c *client, opt ...string) *cmdResult {
+	if len(opt) > 2 {
+		return commandResErrSyntax()
+	}
+	username, password := "default", opt[0]
+	if len(opt) == 2 {
+		username, password = opt[0], opt[1]
+	} else if defaultUserHasPassword() == false {
+		return commandResErr("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if aclAuthenticate(c, username, password) == false {
+		return commandResErrWrongPass()
+	}
+	return commandResOk()
+}
+
+func commandResErrWrongPass() *cmdResult {
+	return commandResErr("WRONGPASS invalid username-password pair or user is disabled.")
+}
+
+func commandResStrings(list []string) []*cmdResult {
+	resList := make([]*cmdResult, len(list))
+	for i, str := range list {
+		resList[i] = commandResString(str)
+	}
+	return resList
+}
+
+func doAcl(c *client, opt ...string) *cmdResult {
+	switch strings.ToLower(opt[0]) {
+	case "setuser":
+		if len(opt) < 2 {
+			return commandResErrArguments("acl|setuser")
+		}
+		if err := aclSetUser(opt[1], opt[2:]...); err != nil {
+			return commandResErr("ERR " + err.Error())
+		}
+		return commandResOk()
+	case "getuser":
+		if len(opt) != 2 {
+			return commandResErrArguments("acl|getuser")
+		}
+		return aclGetUserCmd(opt[1])
+	case "deluser":
+		if len(opt) < 2 {
+			return commandResErrArguments("acl|deluser")
+		}
+		aclLock.Lock()
+		var removed []*aclUser
+		for _, name := range opt[1:] {
+			if name == "default" {
+				aclLock.Unlock()
+				return commandResErr("ERR The 'default' user cannot be removed")
+			}
+		}
+		for _, name := range opt[1:] {
+			if user, ok := aclUsers[name]; ok {
+				delete(aclUsers, name)
+				removed = append(removed, user)
+			}
+		}
+		aclLock.Unlock()
+		killUserClients(removed...)
+		return commandResInt(len(removed))
+	case "list", "users":
+		if len(opt) != 1 {
+			return commandResErrArguments("acl|" + strings.ToLower(opt[0]))
+		}
+		aclLock.RLock()
+		defer aclLock.RUnlock()
+		names := aclUserNames()
+		if strings.ToLower(opt[0]) == "list" {
+			for i, name := range names {
+				names[i] = aclUsers[name].describe()
+			}
+		}
+		return commandResArray(commandResStrings(names))
+	case "whoami":
+		if len(opt) != 1 {
+			return commandResErrArguments("acl|whoami")
+		}
+		return commandResString(c.user())
+	case "cat":
+		if len(opt) > 2 {
+			return commandResErrArguments("acl|cat")
+		}
+		if len(opt) == 1 {
+			names := make([]string, len(aclCategories))
+			for i, cat := range aclCategories {
+				names[i] = cat.name
+			}
+			return commandResArray(commandResStrings(names))
+		}
+		names, ok := aclCategoryCommands(strings.ToLower(opt[1]))
+		if ok == false || strings.ToLower(opt[1]) == "all" {
+			return commandResErr("ERR Unknown category '" + opt[1] + "'")
+		}
+		return commandResArray(commandResStrings(names))
+	case "log":
+		if len(opt) > 2 {
+			return commandResErrArguments("acl|log")
+		}
+		return aclLogCmd(opt[1:]...)
+	case "load", "save":
+		if len(opt) != 1 {
+			return commandResErrArguments("acl|" + strings.ToLower(opt[0]))
+		}
+		path := currentConfig().aclFile
+		if path == "" {
+			return commandResErr("ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+		}
+		var err error
+		if strings.ToLower(opt[0]) == "load" {
+			err = loadAclFile(path)
+		} else {
+			err = saveAclFile(path)
+		}
+		if err != nil {
+			return commandResErr("ERR " + err.Error())
+		}
+		return commandResOk()
+	default:
+		return commandResErr("ERR unknown subcommand '" + opt[0] + "'. Try ACL HELP.")
+	}
+}
+
+func aclGetUserCmd(name string) *cmdResult {
+	aclLock.RLock()
+	defer aclLock.RUnlock()
+	user, ok := aclUsers[name]
+	if ok == false {
+		return commandResNil()
+	}
+	var flags []string
+	if user.enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if user.allKeys {
+		flags = append(flags, "allkeys")
+	}
+	if user.allChannels {
+		flags = append(flags, "allchannels")
+	}
+	if user.allCommands {
+		flags = append(flags, "allcommands")
+	}
+	if user.noPass {
+		flags = append(flags, "nopass")
+	}
+	keys := user.keyPatterns
+	if user.allKeys {
+		keys = []string{"*"}
+	}
+	channels := user.channelPatterns
+	if user.allChannels {
+		channels = []string{"*"}
+	}
+	return commandResMap([]*cmdResult{
+		commandResString("flags"), commandResSet(commandResStrings(flags)),
+		commandResString("passwords"), commandResArray(commandResStrings(user.passwords)),
+		commandResString("commands"), commandResString(user.describeCommands()),
+		commandResString("keys"), commandResArray(commandResStrings(keys)),
+		commandResString("channels"), commandResArray(commandResStrings(channels)),
+	})
+}
+
+func aclLogCmd(opt ...string) *cmdResult {
+	count := 10
+	if len(opt) == 1 {
+		if strings.ToLower(opt[0]) == "reset" {
+			aclLogLock.Lock()
+			aclLogEntries = nil
+			aclLogLock.Unlock()
+			return commandResOk()
+		}
+		var err error
+		count, err = strconv.Atoi(opt[0])
+		if err != nil || count < 0 {
+			return commandResErr("ERR value is out of range, must be positive")
+		}
+	}
+	aclLogLock.Lock()
+	defer aclLogLock.Unlock()
+	now := time.Now()
+	var resList []*cmdResult
+	for i := 0; i < count && i < len(aclLogEntries); i++ {
+		entry := aclLogEntries[i]
+		resList = append(resList, commandResMap([]*cmdResult{
+			commandResString("count"), commandResInt(entry.count),
+			commandResString("reason"), commandResString(entry.reason),
+			commandResString("context"), commandResString(entry.context),
+			commandResString("object"), commandResString(entry.object),
+			commandResString("username"), commandResString(entry.username),
+			commandResString("age-seconds"), commandResDouble(now.Sub(entry.createTime).Seconds()),
+			commandResString("client-info"), commandResString(entry.clientInfo),
+		}))
+	}
+	return commandResArray(resList)
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"bufio"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blockState is a client blocked on list keys. It waits outside of any shard
+// lock: the command that makes one of the keys ready serves it once its own
+// locks are released, taking the blocked clients of a key in FIFO order.
+type blockState struct {
+	db   *redisDb
+	keys []string
+	// target is the destination key of BLMOVE and BRPOPLPUSH, locked along
+	// with the ready key while serving.
+	target       string
+	timeout      time.Duration
+	timeoutReply *cmdResult
+	// serve runs the command on a ready key, with its shard locked.
+	serve   func(key string) *cmdResult
+	waiting bool
+	reply   chan *cmdResult
+}
+
+type readyKey struct {
+	db  *redisDb
+	key string
+}
+
+// blockLock guards the blocked clients of every db and the ready keys. It is
+// taken after the shard locks and nothing is locked under it.
+var blockLock sync.Mutex
+var blockedClients atomic.Int64
+var readyKeys []readyKey
+var readyKeySet = make(map[readyKey]bool)
+
+// blockForKeys blocks the client once the command returns, keys have to be
+// locked so no push is missed between the check and the blocking.
+func blockForKeys(c *client, keys []string, target string, timeout time.Duration, timeoutReply *cmdResult, serve func(string) *cmdResult) *cmdResult {
+	state := &blockState{c.db, nil, target, timeout, timeoutReply, serve, true, make(chan *cmdResult, 1)}
+	blockLock.Lock()
+	defer blockLock.Unlock()
+	// kill and shutdown set their flag before unblocking the client.
+	if c.closing.Load() || shuttingDown.Load() {
+		return nil
+	}
+	for _, key := range keys {
+		if state.db.blockedOn(key, state) {
+			continue
+		}
+		state.keys = append(state.keys, key)
+		state.db.blocking[key] = append(state.db.blocking[key], state)
+	}
+	blockedClients.Add(1)
+	c.blocked = state
+	return nil
+}
+
+func (this *redisDb) blockedOn(key string, state *blockState) bool {
+	for _, other := range this.blocking[key] {
+		if other == state {
+			return true
+		}
+	}
+	return false
+}
+
+// unlink removes the client from the keys it waits on, under blockLock.
+func (this *blockState) unlink() {
+	for _, key := range this.keys {
+		list := this.db.blocking[key]
+		for i, other := range list {
+			if other == this {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(this.db.blocking, key)
+		} else {
+			this.db.blocking[key] = list
+		}
+	}
+	this.waiting = false
+	blockedClients.Add(-1)
+}
+
+// cancel unblocks the client with res, unless it is being served already.
+func (this *blockState) cancel(res *cmdResult) bool {
+	blockLock.Lock()
+	defer blockLock.Unlock()
+	if this.waiting == false {
+		return false
+	}
+	this.unlink()
+	this.reply <- res
+	return true
+}
+
+// waitUnblocked waits until the blocked client is served, times out, is
+// unblocked by CLIENT UNBLOCK, disconnects or is cancelled, and returns its
+// reply.
+func (this *client) waitUnblocked() *cmdResult {
+	state := this.blocked
+	var timeout <-chan time.Time
+	if state.timeout > 0 {
+		timer := time.NewTimer(state.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	disconnected, stopWatching := this.watchDisconnect()
+	var res *cmdResult
+	select {
+	case res = <-state.reply:
+	case <-timeout:
+		state.cancel(state.timeoutReply)
+		res = <-state.reply
+	case <-disconnected:
+		state.cancel(nil)
+		res = <-state.reply
+	case <-this.cancelled:
+		this.blockCancelled = state.cancel(nil)
+		res = <-state.reply
+	}
+	stopWatching()
+	blockLock.Lock()
+	this.blocked = nil
+	blockLock.Unlock()
+	return res
+}
+
+// watchDisconnect reads ahead while the client is blocked, the returned
+// channel is closed when the connection fails. Pipelined commands stay in the
+// reader, once it is full the connection is not watched anymore. stop ends
+// the read.
+func (this *client) watchDisconnect() (<-chan struct{}, func()) {
+	disconnected := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, err := this.reader.Peek(this.reader.Buffered() + 1)
+			if err == bufio.ErrBufferFull {
+				return
+			}
+			if err != nil {
+				close(disconnected)
+				return
+			}
+		}
+	}()
+	return disconnected, func() {
+		this.conn.SetReadDeadline(time.Now())
+		<-done
+		this.conn.SetReadDeadline(time.Time{})
+		// kill and shutdown set the deadline as well, after their flag.
+		if this.closing.Load() || shuttingDown.Load() {
+			this.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// unblock cancels the blocked command of the client, for kill and shutdown.
+func (this *client) unblock() {
+	blockLock.Lock()
+	state := this.blocked
+	blockLock.Unlock()
+	if state != nil {
+		state.cancel(nil)
+	}
+}
+
+func (this *client) isBlocked() bool {
+	blockLock.Lock()
+	defer blockLock.Unlock()
+	return this.blocked != nil
+}
+
+// signalKeyAsReady queues key for serving if clients are blocked on it, it is
+// called on every change of a key with its shard locked.
+func (this *redisDb) signalKeyAsReady(key string) {
+	if blockedClients.Load() == 0 {
+		return
+	}
+	blockLock.Lock()
+	defer blockLock.Unlock()
+	ready := readyKey{this, key}
+	if len(this.blocking[key]) == 0 || readyKeySet[ready] {
+		return
+	}
+	readyKeySet[ready] = true
+	readyKeys = append(readyKeys, ready)
+}
+
+// signalBlockedKeys queues every key clients are blocked on, for commands
+// replacing the contents of a whole db.
+func (this *redisDb) signalBlockedKeys() {
+	blockLock.Lock()
+	keys := make([]string, 0, len(this.blocking))
+	for key := range this.blocking {
+		keys = append(keys, key)
+	}
+	blockLock.Unlock()
+	for _, key := range keys {
+		this.signalKeyAsReady(key)
+	}
+}
+
+// serveBlockedClients runs after every command, with no lock held.
+func serveBlockedClients() {
+	for blockedClients.Load() > 0 {
+		blockLock.Lock()
+		if len(readyKeys) == 0 {
+			blockLock.Unlock()
+			return
+		}
+		ready := readyKeys[0]
+		readyKeys = readyKeys[1:]
+		delete(readyKeySet, ready)
+		blockLock.Unlock()
+		ready.db.serveBlockedKey(ready.key)
+	}
+}
+
+func (this *redisDb) serveBlockedKey(key string) {
+	for {
+		blockLock.Lock()
+		if len(this.blocking[key]) == 0 {
+			blockLock.Unlock()
+			return
+		}
+		state := this.blocking[key][0]
+		blockLock.Unlock()
+		keys := []string{key}
+		if state.target != "" {
+			keys = append(keys, state.target)
+		}
+		locks := newKeyLocks(this, true, keys)
+		locks.lock()
+		l, _ := baseLGet(this, key)
+		if l == nil || l.Len() == 0 {
+			locks.unlock()
+			return
+		}
+		blockLock.Lock()
+		list := this.blocking[key]
+		claimed := state.waiting && len(list) > 0 && list[0] == state
+		if claimed {
+			state.unlink()
+		}
+		blockLock.Unlock()
+		if claimed {
+			state.reply <- state.serve(key)
+		}
+		locks.unlock()
+	}
+}
+
+func unblockClient(id int64, res *cmdResult) bool {
+	for _, other := range clientList() {
+		if other.id != id {
+			continue
+		}
+		blockLock.Lock()
+		state := other.blocked
+		blockLock.Unlock()
+		if state == nil {
+			return false
+		}
+		if res == nil {
+			res = state.timeoutReply
+		}
+		return state.cancel(res)
+	}
+	return false
+}
+
+func parseBlockTimeout(value string) (time.Duration, *cmdResult) {
+	timeout, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(timeout) || timeout > math.MaxInt64/float64(time.Second) {
+		return 0, commandResErr("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, commandResErr("ERR timeout is negative")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
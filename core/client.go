@@ -0,0 +1,367 @@
+package core
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type client struct {
+	id     int64
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	// writeLock guards writer, which other clients use to push messages.
+	writeLock       sync.Mutex
+	out             *clientOutput
+	proto           int
+	certUser        string
+	authUser        *aclUser
+	authenticated   bool
+	addr            string
+	laddr           string
+	createTime      time.Time
+	mu              sync.Mutex
+	name            string
+	db              *redisDb
+	lastInteraction time.Time
+	lastCmd         string
+	qbuf            int
+	obuf            int
+	replyOff        bool
+	replySkip       bool
+	replySkipNext   bool
+	multi           bool
+	multiQueue      []multiCmd
+	multiAborted    bool
+	watchedKeys     []*watchedKey
+	// inExec makes blocking commands return at once inside EXEC.
+	inExec bool
+	// blocked is set by the blocking commands and changed under blockLock.
+	blocked *blockState
+	// cancelled ends a blocked command once closed, for in process sessions.
+	// blockCancelled tells the command was ended by it.
+	cancelled      <-chan struct{}
+	blockCancelled bool
+	// dirtyCAS is set by the clients changing a watched key.
+	dirtyCAS atomic.Bool
+	// The subscriptions are changed under mu as well, for CLIENT LIST.
+	channels map[string]bool
+	patterns map[string]bool
+	closing  atomic.Bool
+}
+
+var clients = make(map[int64]*client)
+var clientsLock sync.Mutex
+var clientsWg sync.WaitGroup
+var nextClientId atomic.Int64
+
+func newClient(conn net.Conn) *client {
+	c := new(client)
+	c.id = nextClientId.Add(1)
+	c.conn = conn
+	c.reader = bufio.NewReader(c)
+	c.out = newClientOutput(conn)
+	c.writer = bufio.NewWriter(c.out)
+	c.channels = make(map[string]bool)
+	c.patterns = make(map[string]bool)
+	c.proto = protoResp2
+	c.authUser = aclDefaultUser()
+	c.db = dbs[0]
+	c.addr = conn.RemoteAddr().String()
+	c.laddr = conn.LocalAddr().String()
+	c.createTime = time.Now()
+	c.lastInteraction = c.createTime
+	return c
+}
+
+// Read flushes pending replies before waiting on the socket, so replies to a
+// pipeline are written in one batch once every queued command is processed.
+func (this *client) Read(p []byte) (int, error) {
+	if err := this.flush(); err != nil {
+		return 0, err
+	}
+	return this.conn.Read(p)
+}
+
+func (this *client) flush() error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	if this.writer.Buffered() == 0 {
+		return nil
+	}
+	return this.writer.Flush()
+}
+
+// clientOutput takes the replies flushed by a client and writes them to the
+// connection from a goroutine of its own, so clients pushing messages to it
+// never wait on its socket.
+type clientOutput struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []byte
+	closed  bool
+	err     error
+	done    chan struct{}
+}
+
+func newClientOutput(conn net.Conn) *clientOutput {
+	out := &clientOutput{conn: conn, done: make(chan struct{})}
+	out.cond = sync.NewCond(&out.mu)
+	go out.loop()
+	return out
+}
+
+func (this *clientOutput) Write(p []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.err != nil {
+		return 0, this.err
+	}
+	this.pending = append(this.pending, p...)
+	this.cond.Signal()
+	return len(p), nil
+}
+
+func (this *clientOutput) loop() {
+	defer close(this.done)
+	var buf []byte
+	for {
+		this.mu.Lock()
+		for len(this.pending) == 0 && this.closed == false && this.err == nil {
+			this.cond.Wait()
+		}
+		if len(this.pending) == 0 || this.err != nil {
+			this.mu.Unlock()
+			return
+		}
+		buf, this.pending = this.pending, buf[:0]
+		this.mu.Unlock()
+		if _, err := this.conn.Write(buf); err != nil {
+			this.abort(err)
+			return
+		}
+	}
+}
+
+func (this *clientOutput) size() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return len(this.pending)
+}
+
+// close lets the pending output drain and waits for it.
+func (this *clientOutput) close() {
+	this.mu.Lock()
+	this.closed = true
+	this.cond.Signal()
+	this.mu.Unlock()
+	<-this.done
+}
+
+// abort drops the pending output, for clients that are not reading it.
+func (this *clientOutput) abort(err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.err == nil {
+		this.err = err
+	}
+	this.pending = nil
+	this.cond.Signal()
+	this.conn.SetWriteDeadline(time.Now())
+}
+
+func (this *client) setKeepAlive(seconds int) {
+	conn := this.conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if ok == false {
+		return
+	}
+	if seconds > 0 {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(time.Duration(seconds) * time.Second)
+	} else {
+		tcpConn.SetKeepAlive(false)
+	}
+}
+
+func (this *client) close() {
+	this.flush()
+	this.out.close()
+	this.conn.Close()
+}
+
+func (this *client) kill(reason string) {
+	serverLog(logVerbose, this, "Closing client: "+reason)
+	this.closing.Store(true)
+	this.conn.SetReadDeadline(time.Now())
+	this.unblock()
+}
+
+func (this *client) beforeCommand(cmd *cmd) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.lastInteraction = time.Now()
+	this.lastCmd = cmd.name
+	this.qbuf = this.reader.Buffered()
+	this.obuf = this.out.size()
+}
+
+func (this *client) writeReply(res *cmdResult) {
+	skip := this.replySkip
+	this.replySkip = this.replySkipNext
+	this.replySkipNext = false
+	if res == nil || skip || this.replyOff {
+		return
+	}
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	res.writeTo(this.writer, this.proto)
+}
+
+func (this *client) getName() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.name
+}
+
+func (this *client) setName(name string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.name = name
+}
+
+func (this *client) user() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.authUser.name
+}
+
+func (this *client) flags() string {
+	flags := ""
+	if this.multi {
+		flags += "x"
+	}
+	if this.dirtyCAS.Load() {
+		flags += "d"
+	}
+	if len(this.channels)+len(this.patterns) > 0 {
+		flags += "P"
+	}
+	if this.isBlocked() {
+		flags += "b"
+	}
+	if flags == "" {
+		return "N"
+	}
+	return flags
+}
+
+func (this *client) clientType() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.subscriptionCount() > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// outputMemory is the size of the replies not handed to the connection yet.
+func (this *client) outputMemory() int {
+	this.writeLock.Lock()
+	buffered := this.writer.Buffered()
+	this.writeLock.Unlock()
+	return buffered + this.out.size()
+}
+
+func (this *client) info() string {
+	omem := this.outputMemory()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	now := time.Now()
+	fields := []string{
+		"id=" + strconv.FormatInt(this.id, 10),
+		"addr=" + this.addr,
+		"laddr=" + this.laddr,
+		"name=" + this.name,
+		"age=" + strconv.Itoa(int(now.Sub(this.createTime)/time.Second)),
+		"idle=" + strconv.Itoa(int(now.Sub(this.lastInteraction)/time.Second)),
+		"flags=" + this.flags(),
+		"db=" + strconv.Itoa(this.db.id),
+		"sub=" + strconv.Itoa(len(this.channels)),
+		"psub=" + strconv.Itoa(len(this.patterns)),
+		"multi=" + strconv.Itoa(this.multiCount()),
+		"qbuf=" + strconv.Itoa(this.qbuf),
+		"qbuf-free=" + strconv.Itoa(this.reader.Size()-this.qbuf),
+		"obl=" + strconv.Itoa(this.obuf),
+		"omem=" + strconv.Itoa(omem),
+		"resp=" + strconv.Itoa(this.proto),
+		"cmd=" + this.lastCmd,
+		"user=" + this.authUser.name,
+	}
+	return strings.Join(fields, " ")
+}
+
+func registerClient(c *client) error {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	if shuttingDown.Load() {
+		return errors.New("server is shutting down")
+	}
+	if len(clients) >= currentConfig().maxClients {
+		statRejectedConn.Add(1)
+		return errors.New("max number of clients reached")
+	}
+	statNumConnections.Add(1)
+	clients[c.id] = c
+	clientsWg.Add(1)
+	return nil
+}
+
+func unregisterClient(c *client) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	delete(clients, c.id)
+	clientsWg.Done()
+}
+
+func clientList() []*client {
+	clientsLock.Lock()
+	list := make([]*client, 0, len(clients))
+	for _, c := range clients {
+		list = append(list, c)
+	}
+	clientsLock.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+func CloseClients() {
+	clientsLock.Lock()
+	shuttingDown.Store(true)
+	now := time.Now()
+	drain := 5 * time.Second
+	if shutdownNoWait.Load() {
+		drain = 0
+	}
+	for _, c := range clients {
+		c.conn.SetReadDeadline(now)
+		c.conn.SetWriteDeadline(now.Add(drain))
+		c.unblock()
+	}
+	clientsLock.Unlock()
+	clientsWg.Wait()
+}
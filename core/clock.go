@@ -0,0 +1,66 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for key expiry.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock only moves when told to, so tests can expire keys without
+// sleeping.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (this *ManualClock) Now() time.Time {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.now
+}
+
+func (this *ManualClock) Set(now time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.now = now
+}
+
+func (this *ManualClock) Add(d time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.now = this.now.Add(d)
+}
+
+var serverClock Clock = systemClock{}
+var clockLock sync.RWMutex
+
+// SetClock replaces the clock used for key expiry, nil restores the system
+// clock.
+func SetClock(clock Clock) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	serverClock = clock
+}
+
+func now() time.Time {
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return serverClock.Now()
+}
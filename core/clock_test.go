@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockExpiry(t *testing.T) {
+	session := newTestSession(t)
+	clock := NewManualClock(time.Unix(1700000000, 0))
+	SetClock(clock)
+	mustDo(t, session, "SET", "key", "value", "EX", "10")
+	if ttl, _ := mustDo(t, session, "TTL", "key").Integer(); ttl != 10 {
+		t.Fatalf("TTL: %d", ttl)
+	}
+	clock.Add(4 * time.Second)
+	if ttl, _ := mustDo(t, session, "PTTL", "key").Integer(); ttl != 6000 {
+		t.Fatalf("PTTL after 4s: %d", ttl)
+	}
+	if value, _ := mustDo(t, session, "GET", "key").Text(); value != "value" {
+		t.Fatalf("GET before expiry: %q", value)
+	}
+	clock.Set(time.Unix(1700000010, 0))
+	if mustDo(t, session, "GET", "key").IsNil() == false {
+		t.Fatal("GET after expiry: key is still there")
+	}
+	if ttl, _ := mustDo(t, session, "TTL", "key").Integer(); ttl != -2 {
+		t.Fatalf("TTL after expiry: %d", ttl)
+	}
+	if _, ok := InspectKey(0, "key"); ok {
+		t.Fatal("InspectKey after expiry: key is still there")
+	}
+}
@@ -7,114 +7,221 @@ type cmd struct {
 
 type cmdHandler struct {
 	name      string
-	handler   func(...string) *cmdResult
+	handler   func(*client, ...string) *cmdResult
 	argsCount int
+	flags     int
+	firstKey  int
+	lastKey   int
+	keyStep   int
 }
 
+const (
+	cmdWrite = 1 << iota
+	cmdRead
+	cmdAdmin
+	cmdFast
+	cmdDangerous
+	cmdNoAuth
+	// cmdExclusive commands run with the whole keyspace locked.
+	cmdExclusive
+	cmdNoMulti
+	cmdCatKeyspace
+	cmdCatString
+	cmdCatBitmap
+	cmdCatList
+	cmdCatHash
+	cmdCatSet
+	cmdCatSortedSet
+	cmdCatConnection
+	cmdCatTransaction
+	cmdCatPubSub
+	cmdCatBlocking
+)
+
 var commandMap = map[string]cmdHandler{
+	//connection
+	"acl":    {"acl", doAcl, -2, cmdAdmin | cmdDangerous, 0, 0, 0},
+	"auth":   {"auth", doAuth, -2, cmdNoAuth | cmdFast | cmdCatConnection, 0, 0, 0},
+	"client": {"client", doClient, -2, cmdAdmin | cmdDangerous | cmdCatConnection, 0, 0, 0},
+	"hello":  {"hello", doHello, -1, cmdNoAuth | cmdFast | cmdCatConnection, 0, 0, 0},
+	"ping":   {"ping", doPing, -1, cmdFast | cmdCatConnection, 0, 0, 0},
+	"select": {"select", doSelect, 2, cmdFast | cmdCatConnection, 0, 0, 0},
+
 	//hashes
-	"hdel":         {"hdel", doHDel, -2},
-	"hexists":      {"hexists", doHExists, 2},
-	"hget":         {"hget", doHGet, 2},
-	"hgetall":      {"hgetall", doHGetAll, 1},
-	"hincrby":      {"hincrby", doHIncrBy, 3},
-	"hincrbyfloat": {"hincrbyfloat", doHIncrByFloat, 3},
-	"hkeys":        {"hkeys", doHKeys, 1},
-	"hlen":         {"hlen", doHLen, 1},
-	"hmget":        {"hmget", doHMGet, -2},
-	"hmset":        {"hmset", doHMSet, -3},
-	"hset":         {"hset", doHSet, 3},
-	"hsetnx":       {"hsetnx", doHSetNx, 3},
-	//"hscan":        {"hscan", doHScan, -2},
-	"hstrlen": {"hstrlen", doHStrlen, 2},
-	"hvals":   {"hvals", doHVals, 1},
+	"hdel":         {"hdel", doHDel, -3, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	"hexists":      {"hexists", doHExists, 3, cmdRead | cmdFast | cmdCatHash, 1, 1, 1},
+	"hget":         {"hget", doHGet, 3, cmdRead | cmdFast | cmdCatHash, 1, 1, 1},
+	"hgetall":      {"hgetall", doHGetAll, 2, cmdRead | cmdCatHash, 1, 1, 1},
+	"hincrby":      {"hincrby", doHIncrBy, 4, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	"hincrbyfloat": {"hincrbyfloat", doHIncrByFloat, 4, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	"hkeys":        {"hkeys", doHKeys, 2, cmdRead | cmdCatHash, 1, 1, 1},
+	"hlen":         {"hlen", doHLen, 2, cmdRead | cmdFast | cmdCatHash, 1, 1, 1},
+	"hmget":        {"hmget", doHMGet, -3, cmdRead | cmdFast | cmdCatHash, 1, 1, 1},
+	"hmset":        {"hmset", doHMSet, -4, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	"hset":         {"hset", doHSet, 4, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	"hsetnx":       {"hsetnx", doHSetNx, 4, cmdWrite | cmdFast | cmdCatHash, 1, 1, 1},
+	//"hscan":        {"hscan", doHScan, -3},
+	"hstrlen": {"hstrlen", doHStrlen, 3, cmdRead | cmdFast | cmdCatHash, 1, 1, 1},
+	"hvals":   {"hvals", doHVals, 2, cmdRead | cmdCatHash, 1, 1, 1},
+
+	//keys
+	"copy":        {"copy", doCopy, -3, cmdWrite | cmdExclusive | cmdCatKeyspace, 1, 2, 1},
+	"dbsize":      {"dbsize", doDbSize, 1, cmdRead | cmdFast | cmdCatKeyspace, 0, 0, 0},
+	"del":         {"del", doDel, -2, cmdWrite | cmdCatKeyspace, 1, -1, 1},
+	"exists":      {"exists", doExists, -2, cmdRead | cmdFast | cmdCatKeyspace, 1, -1, 1},
+	"expire":      {"expire", doExpire, -3, cmdWrite | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"expireat":    {"expireat", doExpireAt, -3, cmdWrite | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"expiretime":  {"expiretime", doExpireTime, 2, cmdRead | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"keys":        {"keys", doKeys, 2, cmdRead | cmdDangerous | cmdCatKeyspace, 0, 0, 0},
+	"move":        {"move", doMove, 3, cmdWrite | cmdFast | cmdExclusive | cmdCatKeyspace, 1, 1, 1},
+	"persist":     {"persist", doPersist, 2, cmdWrite | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"pexpire":     {"pexpire", doPExpire, -3, cmdWrite | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"pexpireat":   {"pexpireat", doPExpireAt, -3, cmdWrite | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"pexpiretime": {"pexpiretime", doPExpireTime, 2, cmdRead | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"pttl":        {"pttl", doPTTL, 2, cmdRead | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"randomkey":   {"randomkey", doRandomKey, 1, cmdRead | cmdCatKeyspace, 0, 0, 0},
+	"rename":      {"rename", doRename, 3, cmdWrite | cmdCatKeyspace, 1, 2, 1},
+	"renamenx":    {"renamenx", doRenameNx, 3, cmdWrite | cmdFast | cmdCatKeyspace, 1, 2, 1},
+	"touch":       {"touch", doTouch, -2, cmdRead | cmdFast | cmdCatKeyspace, 1, -1, 1},
+	"swapdb":      {"swapdb", doSwapDb, 3, cmdWrite | cmdFast | cmdDangerous | cmdExclusive | cmdCatKeyspace, 0, 0, 0},
+	"ttl":         {"ttl", doTTL, 2, cmdRead | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"type":        {"type", doType, 2, cmdRead | cmdFast | cmdCatKeyspace, 1, 1, 1},
+	"unlink":      {"unlink", doDel, -2, cmdWrite | cmdFast | cmdCatKeyspace, 1, -1, 1},
 
 	//lists
-	//"blpop":      {"hvals", doHVals, 1},
-	//"brpop":      {"hvals", doHVals, 1},
-	//"brpoplpush": {"hvals", doHVals, 1},
-	"lindex":    {"lindex", doLIndex, 2},
-	"linsert":   {"linsert", doLInsert, 4},
-	"llen":      {"llen", doLLen, 1},
-	"lpop":      {"lpop", doLPop, 1},
-	"lpush":     {"lpush", doLPush, -2},
-	"lpushx":    {"lpushx", doLPushX, 2},
-	"lrange":    {"lrange", doLRange, 3},
-	"lrem":      {"lrem", doLRem, 3},
-	"lset":      {"lset", doLSet, 3},
-	"ltrim":     {"lTrim", doLTrim, 3},
-	"rpop":      {"rpop", doRPop, 1},
-	"rpoplpush": {"rpoplpush", doRPopLPush, 2},
-	"rpush":     {"rpush", doRPush, -2},
-	"rpushx":    {"rpushx", doRPushX, 2},
+	"blmove":     {"blmove", doBLMove, 6, cmdWrite | cmdCatList | cmdCatBlocking, 1, 2, 1},
+	"blmpop":     {"blmpop", doBLMPop, -5, cmdWrite | cmdCatList | cmdCatBlocking, 3, 3, 1},
+	"blpop":      {"blpop", doBLPop, -3, cmdWrite | cmdCatList | cmdCatBlocking, 1, -2, 1},
+	"brpop":      {"brpop", doBRPop, -3, cmdWrite | cmdCatList | cmdCatBlocking, 1, -2, 1},
+	"brpoplpush": {"brpoplpush", doBRPopLPush, 4, cmdWrite | cmdCatList | cmdCatBlocking, 1, 2, 1},
+	"lindex":     {"lindex", doLIndex, 3, cmdRead | cmdCatList, 1, 1, 1},
+	"linsert":    {"linsert", doLInsert, 5, cmdWrite | cmdCatList, 1, 1, 1},
+	"llen":       {"llen", doLLen, 2, cmdRead | cmdFast | cmdCatList, 1, 1, 1},
+	"lpop":       {"lpop", doLPop, 2, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+	"lpush":      {"lpush", doLPush, -3, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+	"lpushx":     {"lpushx", doLPushX, 3, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+	"lrange":     {"lrange", doLRange, 4, cmdRead | cmdCatList, 1, 1, 1},
+	"lrem":       {"lrem", doLRem, 4, cmdWrite | cmdCatList, 1, 1, 1},
+	"lset":       {"lset", doLSet, 4, cmdWrite | cmdCatList, 1, 1, 1},
+	"ltrim":      {"lTrim", doLTrim, 4, cmdWrite | cmdCatList, 1, 1, 1},
+	"rpop":       {"rpop", doRPop, 2, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+	"rpoplpush":  {"rpoplpush", doRPopLPush, 3, cmdWrite | cmdCatList, 1, 2, 1},
+	"rpush":      {"rpush", doRPush, -3, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+	"rpushx":     {"rpushx", doRPushX, 3, cmdWrite | cmdFast | cmdCatList, 1, 1, 1},
+
+	//pubsub
+	"psubscribe":   {"psubscribe", doPSubscribe, -2, cmdNoMulti | cmdCatPubSub, 0, 0, 0},
+	"publish":      {"publish", doPublish, 3, cmdFast | cmdCatPubSub, 0, 0, 0},
+	"pubsub":       {"pubsub", doPubSub, -2, cmdCatPubSub, 0, 0, 0},
+	"punsubscribe": {"punsubscribe", doPUnsubscribe, -1, cmdNoMulti | cmdCatPubSub, 0, 0, 0},
+	"subscribe":    {"subscribe", doSubscribe, -2, cmdNoMulti | cmdCatPubSub, 0, 0, 0},
+	"unsubscribe":  {"unsubscribe", doUnsubscribe, -1, cmdNoMulti | cmdCatPubSub, 0, 0, 0},
 
 	//server
-	"flushall": {"flushall", doFlushAll, 0},
-	"flushdb":  {"flushdb", doFlushDb, 0},
+	"config":   {"config", doConfig, -2, cmdAdmin | cmdDangerous, 0, 0, 0},
+	"flushall": {"flushall", doFlushAll, -1, cmdWrite | cmdDangerous | cmdExclusive | cmdCatKeyspace, 0, 0, 0},
+	"flushdb":  {"flushdb", doFlushDb, -1, cmdWrite | cmdDangerous | cmdCatKeyspace, 0, 0, 0},
+	"info":     {"info", doInfo, -1, cmdDangerous, 0, 0, 0},
+	"save":     {"save", doSave, 1, cmdAdmin | cmdDangerous | cmdExclusive, 0, 0, 0},
+	"shutdown": {"shutdown", doShutdown, -1, cmdAdmin | cmdDangerous | cmdExclusive, 0, 0, 0},
 
 	//sets
-	"sadd":        {"sadd", doSAdd, -2},
-	"scard":       {"scard", doSCard, 1},
-	"sdiff":       {"sdiff", doSDiff, -1},
-	"sdiffstore":  {"sdiffstore", doSDiffStore, -2},
-	"sinter":      {"sinter", doSInter, -1},
-	"sinterstore": {"sinterstore", doSInterStore, -2},
-	"sismember":   {"sismember", doSIsMember, 2},
-	"smembers":    {"smembers", doSMembers, 1},
-	"smove":       {"smove", doSMove, 3},
-	//"spop":        {"spop", doSPop, -1},
-	//"srandmember": {"srandmember", doSRandMember, -1},
-	"srem":        {"srem", doSRem, -2},
-	"sunion":      {"sunion", doSUnion, -1},
-	"sunionstore": {"sunionstore", doSUnionStore, -2},
-	//"sscan": {"sscan", doSScan, -2},
+	"sadd":        {"sadd", doSAdd, -3, cmdWrite | cmdFast | cmdCatSet, 1, 1, 1},
+	"scard":       {"scard", doSCard, 2, cmdRead | cmdFast | cmdCatSet, 1, 1, 1},
+	"sdiff":       {"sdiff", doSDiff, -2, cmdRead | cmdCatSet, 1, -1, 1},
+	"sdiffstore":  {"sdiffstore", doSDiffStore, -3, cmdWrite | cmdCatSet, 1, -1, 1},
+	"sinter":      {"sinter", doSInter, -2, cmdRead | cmdCatSet, 1, -1, 1},
+	"sinterstore": {"sinterstore", doSInterStore, -3, cmdWrite | cmdCatSet, 1, -1, 1},
+	"sismember":   {"sismember", doSIsMember, 3, cmdRead | cmdFast | cmdCatSet, 1, 1, 1},
+	"smembers":    {"smembers", doSMembers, 2, cmdRead | cmdCatSet, 1, 1, 1},
+	"smove":       {"smove", doSMove, 4, cmdWrite | cmdFast | cmdCatSet, 1, 2, 1},
+	//"spop":        {"spop", doSPop, -2},
+	//"srandmember": {"srandmember", doSRandMember, -2},
+	"srem":        {"srem", doSRem, -3, cmdWrite | cmdFast | cmdCatSet, 1, 1, 1},
+	"sunion":      {"sunion", doSUnion, -2, cmdRead | cmdCatSet, 1, -1, 1},
+	"sunionstore": {"sunionstore", doSUnionStore, -3, cmdWrite | cmdCatSet, 1, -1, 1},
+	//"sscan": {"sscan", doSScan, -3},
 
 	//sorted sets
-	"zadd":             {"zadd", doZAdd, -3},
-	"zcard":            {"zcard", doZCard, 1},
-	"zcount":           {"zcount", doZCount, 3},
-	"zincrby":          {"zincrby", doZIncrBy, 3},
-	"zinterstore":      {"zinterstore", doZInterStore, -3},
-	"zlexcount":        {"zlexcount", doZLexCount, 3},
-	"zrange":           {"zrange", doZRange, -3},
-	"zrangebylex":      {"zrangebylex", doZRangeByLex, -3},
-	"zrevrangebylex":   {"zrevrangebylex", doZRevRangeByLex, -3},
-	"zrangebyscore":    {"zrangebyscore", doZRangeByScore, -3},
-	"zrank":            {"zrank", doZRank, 2},
-	"zrem":             {"zrem", doZRem, -2},
-	"zremrangebylex":   {"zremrangebylex", doZRemRrangeByLex, 3},
-	"zremrangebyrank":  {"zremrangebyrank", doZRemRangeByRank, 3},
-	"zremrangebyscore": {"zremrangebyscore", doZRemRangeByScore, 3},
-	"zrevrange":        {"zrevrange", doZRevRange, -3},
-	"zrevrangebyscore": {"zrevrangebyscore", doZRevRangeByScore, -3},
-	"zrevrank":         {"zrevrank", doZRevRank, 2},
-	"zsocre":           {"zscore", doZScore, 2},
-	"zunionstore":      {"zunionstore", doZUnionStore, -3},
-	//"zscan":            {"zscan", doZScan, -2},
+	"zadd":             {"zadd", doZAdd, -4, cmdWrite | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zcard":            {"zcard", doZCard, 2, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zcount":           {"zcount", doZCount, 4, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zincrby":          {"zincrby", doZIncrBy, 4, cmdWrite | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zinterstore":      {"zinterstore", doZInterStore, -4, cmdWrite | cmdCatSortedSet, 1, 1, 1},
+	"zlexcount":        {"zlexcount", doZLexCount, 4, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zrange":           {"zrange", doZRange, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrangebylex":      {"zrangebylex", doZRangeByLex, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrevrangebylex":   {"zrevrangebylex", doZRevRangeByLex, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrangebyscore":    {"zrangebyscore", doZRangeByScore, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrank":            {"zrank", doZRank, 3, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zrem":             {"zrem", doZRem, -3, cmdWrite | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zremrangebylex":   {"zremrangebylex", doZRemRrangeByLex, 4, cmdWrite | cmdCatSortedSet, 1, 1, 1},
+	"zremrangebyrank":  {"zremrangebyrank", doZRemRangeByRank, 4, cmdWrite | cmdCatSortedSet, 1, 1, 1},
+	"zremrangebyscore": {"zremrangebyscore", doZRemRangeByScore, 4, cmdWrite | cmdCatSortedSet, 1, 1, 1},
+	"zrevrange":        {"zrevrange", doZRevRange, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrevrangebyscore": {"zrevrangebyscore", doZRevRangeByScore, -4, cmdRead | cmdCatSortedSet, 1, 1, 1},
+	"zrevrank":         {"zrevrank", doZRevRank, 3, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zsocre":           {"zscore", doZScore, 3, cmdRead | cmdFast | cmdCatSortedSet, 1, 1, 1},
+	"zunionstore":      {"zunionstore", doZUnionStore, -4, cmdWrite | cmdCatSortedSet, 1, 1, 1},
+	//"zscan":            {"zscan", doZScan, -3},
 
 	//strings
-	"append":   {"append", doAppend, 2},
-	"bitcount": {"bitcount", doBitCount, -1},
-	//"bitfield": {"bitfiled", doBitField, -1},
-	"bitop":       {"bitop", doBitOp, -3},
-	"bitpos":      {"bitpos", doBitPos, -2},
-	"decr":        {"decr", doDecr, 1},
-	"decrby":      {"decrby", doDecrBy, 2},
-	"get":         {"get", doGet, 1},
-	"getbit":      {"getbit", doGetBit, 2},
-	"getrange":    {"getrange", doGetRange, 3},
-	"getset":      {"getset", doGetSet, 2},
-	"incr":        {"incr", doIncr, 1},
-	"incrby":      {"incrby", doIncrBy, 2},
-	"incrbyfloat": {"incrbyfloat", doIncrByFloat, 2},
-	"mget":        {"mget", doMGet, -1},
-	"mset":        {"mset", doMSet, -2},
-	"msetnx":      {"msetnx", doMSetNx, -2},
-	"psetex":      {"psetex", doPSetEx, 3},
-	"set":         {"set", doSet, -2},
-	"setbit":      {"setbit", doSetBit, 3},
-	"setex":       {"setex", doSetEx, 3},
-	"setnx":       {"setnx", doSetNx, 2},
-	"setrange":    {"setrange", doSetRange, 3},
-	"strlen":      {"strlen", doStrlen, 1},
+	"append":   {"append", doAppend, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"bitcount": {"bitcount", doBitCount, -2, cmdRead | cmdCatBitmap, 1, 1, 1},
+	//"bitfield": {"bitfiled", doBitField, -2},
+	"bitop":       {"bitop", doBitOp, -4, cmdWrite | cmdCatBitmap, 2, -1, 1},
+	"bitpos":      {"bitpos", doBitPos, -3, cmdRead | cmdCatBitmap, 1, 1, 1},
+	"decr":        {"decr", doDecr, 2, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"decrby":      {"decrby", doDecrBy, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"get":         {"get", doGet, 2, cmdRead | cmdFast | cmdCatString, 1, 1, 1},
+	"getbit":      {"getbit", doGetBit, 3, cmdRead | cmdFast | cmdCatBitmap, 1, 1, 1},
+	"getrange":    {"getrange", doGetRange, 4, cmdRead | cmdCatString, 1, 1, 1},
+	"getset":      {"getset", doGetSet, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"incr":        {"incr", doIncr, 2, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"incrby":      {"incrby", doIncrBy, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"incrbyfloat": {"incrbyfloat", doIncrByFloat, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"mget":        {"mget", doMGet, -2, cmdRead | cmdFast | cmdCatString, 1, -1, 1},
+	"mset":        {"mset", doMSet, -3, cmdWrite | cmdCatString, 1, -1, 2},
+	"msetnx":      {"msetnx", doMSetNx, -3, cmdWrite | cmdCatString, 1, -1, 2},
+	"psetex":      {"psetex", doPSetEx, 4, cmdWrite | cmdCatString, 1, 1, 1},
+	"set":         {"set", doSet, -3, cmdWrite | cmdCatString, 1, 1, 1},
+	"setbit":      {"setbit", doSetBit, 4, cmdWrite | cmdCatBitmap, 1, 1, 1},
+	"setex":       {"setex", doSetEx, 4, cmdWrite | cmdCatString, 1, 1, 1},
+	"setnx":       {"setnx", doSetNx, 3, cmdWrite | cmdFast | cmdCatString, 1, 1, 1},
+	"setrange":    {"setrange", doSetRange, 4, cmdWrite | cmdCatString, 1, 1, 1},
+	"strlen":      {"strlen", doStrlen, 2, cmdRead | cmdFast | cmdCatString, 1, 1, 1},
+
+	//transactions
+	"discard": {"discard", doDiscard, 1, cmdFast | cmdCatTransaction, 0, 0, 0},
+	"exec":    {"exec", doExec, 1, cmdCatTransaction, 0, 0, 0},
+	"multi":   {"multi", doMulti, 1, cmdFast | cmdCatTransaction, 0, 0, 0},
+	"unwatch": {"unwatch", doUnwatch, 1, cmdFast | cmdCatTransaction, 0, 0, 0},
+	"watch":   {"watch", doWatch, -2, cmdFast | cmdCatTransaction, 1, -1, 1},
+}
+
+// commandKeysFuncs extracts the keys of commands giving their number as an
+// argument.
+var commandKeysFuncs = map[string]func([]string) []string{
+	"blmpop": blmpopKeys,
+}
+
+// commandKeys returns the key arguments of a command, with positions counted
+// like argv where the command name is at 0 and a negative lastKey counts from
+// the end.
+func commandKeys(handler cmdHandler, params []string) []string {
+	if handler.firstKey == 0 {
+		return nil
+	}
+	if keysFunc, ok := commandKeysFuncs[handler.name]; ok {
+		return keysFunc(params)
+	}
+	lastKey := handler.lastKey
+	if lastKey < 0 {
+		lastKey = len(params) + 1 + lastKey
+	}
+	var keys []string
+	for i := handler.firstKey; i <= lastKey && i <= len(params); i += handler.keyStep {
+		keys = append(keys, params[i-1])
+	}
+	return keys
 }
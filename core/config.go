@@ -0,0 +1,507 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type config struct {
+	bind                   []string
+	port                   int
+	unixSocket             string
+	unixSocketPerm         int
+	timeout                int
+	maxClients             int
+	protoMaxBulkLen        int64
+	protoMaxMultibulkLen   int
+	protoInlineMaxSize     int
+	clientQueryBufferLimit int64
+	tcpKeepalive           int
+	logLevel               string
+	logFile                string
+	logFormat              string
+	dir                    string
+	dbFilename             string
+	save                   string
+	maxMemory              int64
+	maxMemoryPolicy        string
+	tlsPort                int
+	tlsCertFile            string
+	tlsKeyFile             string
+	tlsCaCertFile          string
+	tlsAuthClients         string
+	tlsClientsUser         string
+	requirePass            string
+	aclFile                string
+	aclLogMaxLen           int
+	protectedMode          string
+	enableProtectedConfigs string
+	hz                     int
+	databases              int
+	notifyKeyspaceEvents   int
+}
+
+type configOption struct {
+	name       string
+	modifiable bool
+	get        func(*config) string
+	set        func(*config, string) error
+}
+
+var serverConfig = config{
+	bind:                   []string{"0.0.0.0"},
+	port:                   5000,
+	unixSocketPerm:         0,
+	timeout:                0,
+	maxClients:             10000,
+	protoMaxBulkLen:        512 * 1024 * 1024,
+	protoMaxMultibulkLen:   1024 * 1024,
+	protoInlineMaxSize:     64 * 1024,
+	clientQueryBufferLimit: 1024 * 1024 * 1024,
+	tcpKeepalive:           300,
+	logLevel:               "notice",
+	logFormat:              "text",
+	dir:                    ".",
+	dbFilename:             "dump.gob",
+	save:                   "",
+	maxMemory:              0,
+	maxMemoryPolicy:        "noeviction",
+	tlsAuthClients:         "yes",
+	tlsClientsUser:         "off",
+	aclLogMaxLen:           128,
+	protectedMode:          "yes",
+	enableProtectedConfigs: "no",
+	hz:                     10,
+	databases:              16,
+}
+var defaultConfig = serverConfig
+var configLock sync.RWMutex
+var configFile string
+var configApplyHooks = make(map[string]func(*config) error)
+
+// protectedConfigs choose where the server writes files, CONFIG SET only
+// changes them as allowed by enable-protected-configs.
+var protectedConfigs = map[string]bool{"dir": true, "dbfilename": true}
+
+var configOptions = []*configOption{
+	{"bind", false, func(conf *config) string {
+		return strings.Join(conf.bind, " ")
+	}, func(conf *config, value string) error {
+		addrs := strings.Fields(value)
+		if len(addrs) == 0 {
+			return errors.New("bind requires at least one address")
+		}
+		conf.bind = addrs
+		return nil
+	}},
+	intConfigOption("port", false, func(conf *config) *int { return &conf.port }, 0, 65535),
+	stringConfigOption("unixsocket", false, func(conf *config) *string { return &conf.unixSocket }),
+	{"unixsocketperm", false, func(conf *config) string {
+		return strconv.FormatInt(int64(conf.unixSocketPerm), 8)
+	}, func(conf *config, value string) error {
+		perm, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || perm > 0777 {
+			return errors.New("Invalid socket file permissions")
+		}
+		conf.unixSocketPerm = int(perm)
+		return nil
+	}},
+	intConfigOption("timeout", true, func(conf *config) *int { return &conf.timeout }, 0, 1<<31-1),
+	intConfigOption("maxclients", true, func(conf *config) *int { return &conf.maxClients }, 1, 1<<31-1),
+	memoryConfigOption("proto-max-bulk-len", true, func(conf *config) *int64 { return &conf.protoMaxBulkLen }, 1024*1024),
+	intConfigOption("proto-max-multibulk-len", true, func(conf *config) *int { return &conf.protoMaxMultibulkLen }, 1, 1<<31-1),
+	intConfigOption("proto-inline-max-size", true, func(conf *config) *int { return &conf.protoInlineMaxSize }, 1024, 1<<31-1),
+	memoryConfigOption("client-query-buffer-limit", true, func(conf *config) *int64 { return &conf.clientQueryBufferLimit }, 1024*1024),
+	intConfigOption("tcp-keepalive", true, func(conf *config) *int { return &conf.tcpKeepalive }, 0, 1<<31-1),
+	intConfigOption("databases", false, func(conf *config) *int { return &conf.databases }, 1, 1<<31-1),
+	intConfigOption("hz", true, func(conf *config) *int { return &conf.hz }, 1, 500),
+	enumConfigOption("loglevel", true, func(conf *config) *string { return &conf.logLevel }, "debug", "verbose", "notice", "warning"),
+	stringConfigOption("logfile", false, func(conf *config) *string { return &conf.logFile }),
+	enumConfigOption("log-format", true, func(conf *config) *string { return &conf.logFormat }, "text", "json"),
+	{"dir", true, func(conf *config) string {
+		return conf.dir
+	}, func(conf *config, value string) error {
+		info, err := os.Stat(value)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() == false {
+			return errors.New("not a directory")
+		}
+		conf.dir = value
+		return nil
+	}},
+	{"dbfilename", true, func(conf *config) string {
+		return conf.dbFilename
+	}, func(conf *config, value string) error {
+		if value == "" || filepath.Base(value) != value {
+			return errors.New("dbfilename can't be a path, just a filename")
+		}
+		conf.dbFilename = value
+		return nil
+	}},
+	{"save", true, func(conf *config) string {
+		return conf.save
+	}, func(conf *config, value string) error {
+		params := strings.Fields(value)
+		if len(params)%2 == 1 {
+			return errors.New("Invalid save parameters")
+		}
+		for _, param := range params {
+			if n, err := strconv.Atoi(param); err != nil || n < 0 {
+				return errors.New("Invalid save parameters")
+			}
+		}
+		conf.save = strings.Join(params, " ")
+		return nil
+	}},
+	// There is no eviction, only the defaults are accepted.
+	{"maxmemory", true, func(conf *config) string {
+		return strconv.FormatInt(conf.maxMemory, 10)
+	}, func(conf *config, value string) error {
+		mem, err := parseMemory(value)
+		if err != nil {
+			return err
+		}
+		if mem != 0 {
+			return errors.New("maxmemory is not supported, it must be 0")
+		}
+		return nil
+	}},
+	enumConfigOption("maxmemory-policy", true, func(conf *config) *string { return &conf.maxMemoryPolicy }, "noeviction"),
+	intConfigOption("tls-port", false, func(conf *config) *int { return &conf.tlsPort }, 0, 65535),
+	stringConfigOption("tls-cert-file", true, func(conf *config) *string { return &conf.tlsCertFile }),
+	stringConfigOption("tls-key-file", true, func(conf *config) *string { return &conf.tlsKeyFile }),
+	stringConfigOption("tls-ca-cert-file", true, func(conf *config) *string { return &conf.tlsCaCertFile }),
+	enumConfigOption("tls-auth-clients", true, func(conf *config) *string { return &conf.tlsAuthClients }, "yes", "no", "optional"),
+	enumConfigOption("tls-auth-clients-user", true, func(conf *config) *string { return &conf.tlsClientsUser }, "off", "cn"),
+	stringConfigOption("requirepass", true, func(conf *config) *string { return &conf.requirePass }),
+	stringConfigOption("aclfile", false, func(conf *config) *string { return &conf.aclFile }),
+	intConfigOption("acllog-max-len", true, func(conf *config) *int { return &conf.aclLogMaxLen }, 0, 1<<31-1),
+	enumConfigOption("protected-mode", true, func(conf *config) *string { return &conf.protectedMode }, "yes", "no"),
+	enumConfigOption("enable-protected-configs", false, func(conf *config) *string { return &conf.enableProtectedConfigs }, "no", "yes", "local"),
+	{"notify-keyspace-events", true, func(conf *config) string {
+		return keyspaceEventsString(conf.notifyKeyspaceEvents)
+	}, func(conf *config, value string) error {
+		classes, err := parseKeyspaceEvents(value)
+		if err != nil {
+			return err
+		}
+		conf.notifyKeyspaceEvents = classes
+		return nil
+	}},
+}
+
+func intConfigOption(name string, modifiable bool, field func(*config) *int, min, max int) *configOption {
+	return &configOption{name, modifiable, func(conf *config) string {
+		return strconv.Itoa(*field(conf))
+	}, func(conf *config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("argument couldn't be parsed into an integer")
+		}
+		if n < min || n > max {
+			return errors.New("argument must be between " + strconv.Itoa(min) + " and " + strconv.Itoa(max) + " inclusive")
+		}
+		*field(conf) = n
+		return nil
+	}}
+}
+
+func stringConfigOption(name string, modifiable bool, field func(*config) *string) *configOption {
+	return &configOption{name, modifiable, func(conf *config) string {
+		return *field(conf)
+	}, func(conf *config, value string) error {
+		*field(conf) = value
+		return nil
+	}}
+}
+
+func enumConfigOption(name string, modifiable bool, field func(*config) *string, values ...string) *configOption {
+	return &configOption{name, modifiable, func(conf *config) string {
+		return *field(conf)
+	}, func(conf *config, value string) error {
+		value = strings.ToLower(value)
+		for _, v := range values {
+			if v == value {
+				*field(conf) = value
+				return nil
+			}
+		}
+		return errors.New("argument(s) must be one of the following: " + strings.Join(values, ", "))
+	}}
+}
+
+func memoryConfigOption(name string, modifiable bool, field func(*config) *int64, min int64) *configOption {
+	return &configOption{name, modifiable, func(conf *config) string {
+		return strconv.FormatInt(*field(conf), 10)
+	}, func(conf *config, value string) error {
+		mem, err := parseMemory(value)
+		if err != nil {
+			return err
+		}
+		if mem < min {
+			return errors.New("argument must be at least " + strconv.FormatInt(min, 10))
+		}
+		*field(conf) = mem
+		return nil
+	}}
+}
+
+func parseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"gb", 1024 * 1024 * 1024}, {"mb", 1024 * 1024}, {"kb", 1024},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+	lower := strings.ToLower(value)
+	var mul int64 = 1
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = lower[:len(lower)-len(unit.suffix)]
+			mul = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mul, nil
+}
+
+func findConfigOption(name string) *configOption {
+	name = strings.ToLower(name)
+	for _, option := range configOptions {
+		if option.name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+func currentConfig() config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return serverConfig
+}
+
+func ConfigNames() []string {
+	names := make([]string, len(configOptions))
+	for i, option := range configOptions {
+		names[i] = option.name
+	}
+	return names
+}
+
+func SetConfig(name, value string) error {
+	option := findConfigOption(name)
+	if option == nil {
+		return errors.New("Bad directive or wrong number of arguments")
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	return option.set(&serverConfig, value)
+}
+
+func LoadConfigFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		args, err := splitArgs(line)
+		if err == nil && len(args) < 2 {
+			err = errors.New("wrong number of arguments")
+		}
+		if err == nil {
+			err = SetConfig(args[0], strings.Join(args[1:], " "))
+		}
+		if err != nil {
+			return errors.New("line " + strconv.Itoa(lineNum) + ": '" + line + "': " + err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	configFile, _ = filepath.Abs(path)
+	return nil
+}
+
+func ListenAddrs() []string {
+	conf := currentConfig()
+	if conf.port == 0 {
+		return nil
+	}
+	addrs := make([]string, len(conf.bind))
+	for i, host := range conf.bind {
+		addrs[i] = net.JoinHostPort(host, strconv.Itoa(conf.port))
+	}
+	return addrs
+}
+
+func UnixSocket() (string, os.FileMode) {
+	conf := currentConfig()
+	return conf.unixSocket, os.FileMode(conf.unixSocketPerm)
+}
+
+func rewriteConfig() error {
+	if configFile == "" {
+		return errors.New("The server is running without a config file")
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	conf := currentConfig()
+	written := make(map[string]bool)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			lines = append(lines, line)
+			continue
+		}
+		args, err := splitArgs(trimmed)
+		var option *configOption
+		if err == nil && len(args) > 0 {
+			option = findConfigOption(args[0])
+		}
+		if option == nil {
+			lines = append(lines, line)
+			continue
+		}
+		if written[option.name] {
+			continue
+		}
+		written[option.name] = true
+		lines = append(lines, formatConfigLine(option, &conf))
+	}
+	generated := false
+	for _, line := range lines {
+		if line == "# Generated by CONFIG REWRITE" {
+			generated = true
+		}
+	}
+	for _, option := range configOptions {
+		if written[option.name] || option.get(&conf) == option.get(&defaultConfig) {
+			continue
+		}
+		if generated == false {
+			lines = append(lines, "# Generated by CONFIG REWRITE")
+			generated = true
+		}
+		lines = append(lines, formatConfigLine(option, &conf))
+	}
+	tmpFile := configFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, configFile)
+}
+
+func formatConfigLine(option *configOption, conf *config) string {
+	value := option.get(conf)
+	if option.name == "bind" || option.name == "save" {
+		return option.name + " " + value
+	}
+	return option.name + " " + quoteConfigValue(value)
+}
+
+func quoteConfigValue(value string) string {
+	if value != "" && strings.ContainsAny(value, " \t\"'\\") == false {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func doConfig(c *client, opt ...string) *cmdResult {
+	switch strings.ToLower(opt[0]) {
+	case "get":
+		if len(opt) < 2 {
+			return commandResErrArguments("config|get")
+		}
+		conf := currentConfig()
+		var resList []*cmdResult
+		for _, option := range configOptions {
+			for _, pattern := range opt[1:] {
+				if stringMatch(pattern, option.name, true) {
+					resList = append(resList, commandResString(option.name), commandResString(option.get(&conf)))
+					break
+				}
+			}
+		}
+		return commandResMap(resList)
+	case "set":
+		if len(opt) < 3 || len(opt)%2 == 0 {
+			return commandResErrArguments("config|set")
+		}
+		configLock.Lock()
+		defer configLock.Unlock()
+		backup := serverConfig
+		for i := 1; i < len(opt); i += 2 {
+			option := findConfigOption(opt[i])
+			var err error
+			if option == nil {
+				err = errors.New("unknown option or number of arguments")
+			} else if option.modifiable == false {
+				err = errors.New("can't set immutable config")
+			} else if protectedConfigs[option.name] && protectedConfigAllowed(c, &serverConfig) == false {
+				err = errors.New("can't set protected config")
+			} else {
+				err = option.set(&serverConfig, opt[i+1])
+			}
+			if err != nil {
+				serverConfig = backup
+				return commandResErr("ERR CONFIG SET failed (possibly related to argument '" + opt[i] + "') - " + err.Error())
+			}
+		}
+		for i := 1; i < len(opt); i += 2 {
+			hook, ok := configApplyHooks[findConfigOption(opt[i]).name]
+			if ok == false {
+				continue
+			}
+			if err := hook(&serverConfig); err != nil {
+				serverConfig = backup
+				return commandResErr("ERR CONFIG SET failed (possibly related to argument '" + opt[i] + "') - " + err.Error())
+			}
+		}
+		return commandResOk()
+	case "rewrite":
+		if len(opt) != 1 {
+			return commandResErrArguments("config|rewrite")
+		}
+		if err := rewriteConfig(); err != nil {
+			return commandResErr("ERR Rewriting config file: " + err.Error())
+		}
+		return commandResOk()
+	default:
+		return commandResErr("ERR unknown subcommand '" + opt[0] + "'. Try CONFIG HELP.")
+	}
+}
+
+func protectedConfigAllowed(c *client, conf *config) bool {
+	switch conf.enableProtectedConfigs {
+	case "yes":
+		return true
+	case "local":
+		return isLocalClient(c)
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestConfigSetProtectedConfigs(t *testing.T) {
+	session := newTestSession(t)
+	dir := t.TempDir()
+	for _, args := range [][]string{{"dir", dir}, {"dbfilename", "other.gob"}} {
+		reply := session.Do("CONFIG", "SET", args[0], args[1])
+		if reply.Err() == nil {
+			t.Fatalf("CONFIG SET %s: want an error", args[0])
+		}
+	}
+	if err := SetConfig("enable-protected-configs", "yes"); err != nil {
+		t.Fatal(err)
+	}
+	mustDo(t, session, "CONFIG", "SET", "dir", dir)
+	if currentConfig().dir != dir {
+		t.Fatalf("dir: %s", currentConfig().dir)
+	}
+	reply := session.Do("CONFIG", "SET", "enable-protected-configs", "no")
+	if reply.Err() == nil {
+		t.Fatal("CONFIG SET enable-protected-configs: want an error")
+	}
+}
@@ -0,0 +1,312 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+)
+
+func doHello(c *client, opt ...string) *cmdResult {
+	proto := c.proto
+	name := ""
+	setName := false
+	username, password := "", ""
+	auth := false
+	if len(opt) > 0 {
+		var err error
+		proto, err = strconv.Atoi(opt[0])
+		if err != nil {
+			return commandResErr("ERR Protocol version is not an integer or out of range")
+		}
+		if proto != protoResp2 && proto != protoResp3 {
+			return commandResErr("NOPROTO unsupported protocol version")
+		}
+		for i := 1; i < len(opt); i++ {
+			switch strings.ToLower(opt[i]) {
+			case "auth":
+				if i+2 >= len(opt) {
+					return commandResErrSyntax()
+				}
+				username, password = opt[i+1], opt[i+2]
+				auth = true
+				i += 2
+			case "setname":
+				if i+1 >= len(opt) {
+					return commandResErrSyntax()
+				}
+				i++
+				if validClientName(opt[i]) == false {
+					return commandResErrClientName()
+				}
+				name = opt[i]
+				setName = true
+			default:
+				return commandResErr("ERR Syntax error in HELLO option '" + opt[i] + "'")
+			}
+		}
+	}
+	if auth {
+		if aclAuthenticate(c, username, password) == false {
+			return commandResErrWrongPass()
+		}
+	} else if c.authenticated == false {
+		return commandResErr("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	c.mu.Lock()
+	c.proto = proto
+	if setName {
+		c.name = name
+	}
+	c.mu.Unlock()
+	return commandResMap([]*cmdResult{
+		commandResString("server"), commandResString(serverName),
+		commandResString("version"), commandResString(serverVersion),
+		commandResString("proto"), commandResInt(c.proto),
+		commandResString("id"), commandResInt(int(c.id)),
+		commandResString("mode"), commandResString("standalone"),
+		commandResString("role"), commandResString("master"),
+		commandResString("modules"), commandResEmptyArray(),
+	})
+}
+
+func doPing(c *client, opt ...string) *cmdResult {
+	if len(opt) > 1 {
+		return commandResErrArguments("ping")
+	}
+	message := ""
+	if len(opt) == 1 {
+		message = opt[0]
+	}
+	if c.proto == protoResp2 && c.subscriptionCount() > 0 {
+		return commandResArray(commandResStrings([]string{"pong", message}))
+	}
+	if len(opt) == 0 {
+		return commandResMsg("PONG")
+	}
+	return commandResString(message)
+}
+
+func doSelect(c *client, opt ...string) *cmdResult {
+	db, res := selectDb(opt[0])
+	if res != nil {
+		return res
+	}
+	c.mu.Lock()
+	c.db = db
+	c.mu.Unlock()
+	return commandResOk()
+}
+
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func commandResErrClientName() *cmdResult {
+	return commandResErr("ERR Client names cannot contain spaces, newlines or special characters.")
+}
+
+func doClient(c *client, opt ...string) *cmdResult {
+	switch strings.ToLower(opt[0]) {
+	case "id":
+		if len(opt) != 1 {
+			return commandResErrArguments("client|id")
+		}
+		return commandResInt(int(c.id))
+	case "info":
+		if len(opt) != 1 {
+			return commandResErrArguments("client|info")
+		}
+		return commandResVerbatim(c.info() + "\n")
+	case "list":
+		return clientListCmd(opt[1:]...)
+	case "setname":
+		if len(opt) != 2 {
+			return commandResErrArguments("client|setname")
+		}
+		if validClientName(opt[1]) == false {
+			return commandResErrClientName()
+		}
+		c.setName(opt[1])
+		return commandResOk()
+	case "getname":
+		if len(opt) != 1 {
+			return commandResErrArguments("client|getname")
+		}
+		name := c.getName()
+		if name == "" {
+			return commandResNil()
+		}
+		return commandResString(name)
+	case "kill":
+		if len(opt) < 2 {
+			return commandResErrArguments("client|kill")
+		}
+		return clientKillCmd(c, opt[1:]...)
+	case "unblock":
+		if len(opt) != 2 && len(opt) != 3 {
+			return commandResErrArguments("client|unblock")
+		}
+		id, err := strconv.ParseInt(opt[1], 10, 64)
+		if err != nil {
+			return commandResErrParseInt("value")
+		}
+		var res *cmdResult
+		if len(opt) == 3 {
+			switch strings.ToLower(opt[2]) {
+			case "timeout":
+			case "error":
+				res = commandResErr("UNBLOCKED client unblocked via CLIENT UNBLOCK")
+			default:
+				return commandResErr("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+			}
+		}
+		if unblockClient(id, res) {
+			return commandResInt(1)
+		}
+		return commandResInt(0)
+	case "reply":
+		if len(opt) != 2 {
+			return commandResErrArguments("client|reply")
+		}
+		switch strings.ToLower(opt[1]) {
+		case "on":
+			c.replyOff = false
+			c.replySkipNext = false
+			return commandResOk()
+		case "off":
+			c.replyOff = true
+			return nil
+		case "skip":
+			if c.replyOff == false {
+				c.replySkipNext = true
+			}
+			return nil
+		}
+		return commandResErrSyntax()
+	default:
+		return commandResErr("ERR unknown subcommand '" + opt[0] + "'. Try CLIENT HELP.")
+	}
+}
+
+func clientListCmd(opt ...string) *cmdResult {
+	var ids map[int64]bool
+	clientType := ""
+	for i := 0; i < len(opt); i++ {
+		switch strings.ToLower(opt[i]) {
+		case "type":
+			if i+1 >= len(opt) {
+				return commandResErrSyntax()
+			}
+			i++
+			clientType = strings.ToLower(opt[i])
+			if clientType != "normal" && clientType != "pubsub" && clientType != "master" && clientType != "replica" {
+				return commandResErr("ERR Unknown client type '" + opt[i] + "'")
+			}
+		case "id":
+			if i+1 >= len(opt) {
+				return commandResErrSyntax()
+			}
+			ids = make(map[int64]bool)
+			for i+1 < len(opt) {
+				id, err := strconv.ParseInt(opt[i+1], 10, 64)
+				if err != nil || id <= 0 {
+					return commandResErr("ERR Invalid client ID")
+				}
+				ids[id] = true
+				i++
+			}
+		default:
+			return commandResErrSyntax()
+		}
+	}
+	var lines []string
+	for _, other := range clientList() {
+		if ids != nil && ids[other.id] == false {
+			continue
+		}
+		if clientType != "" && other.clientType() != clientType {
+			continue
+		}
+		lines = append(lines, other.info()+"\n")
+	}
+	return commandResVerbatim(strings.Join(lines, ""))
+}
+
+func clientKillCmd(c *client, opt ...string) *cmdResult {
+	if len(opt) == 1 {
+		for _, other := range clientList() {
+			if other.addr == opt[0] {
+				other.kill("killed by client " + strconv.FormatInt(c.id, 10))
+				return commandResOk()
+			}
+		}
+		return commandResErr("ERR No such client")
+	}
+	if len(opt)%2 != 0 {
+		return commandResErrSyntax()
+	}
+	var id int64
+	addr, laddr, user, clientType := "", "", "", ""
+	skipMe := true
+	for i := 0; i < len(opt); i += 2 {
+		value := opt[i+1]
+		switch strings.ToLower(opt[i]) {
+		case "id":
+			var err error
+			id, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return commandResErr("ERR client-id should be greater than 0")
+			}
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "user":
+			user = value
+		case "type":
+			clientType = strings.ToLower(value)
+			if clientType != "normal" && clientType != "pubsub" && clientType != "master" && clientType != "replica" {
+				return commandResErr("ERR Unknown client type '" + value + "'")
+			}
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return commandResErrSyntax()
+			}
+		default:
+			return commandResErrSyntax()
+		}
+	}
+	killed := 0
+	for _, other := range clientList() {
+		if id != 0 && other.id != id {
+			continue
+		}
+		if addr != "" && other.addr != addr {
+			continue
+		}
+		if laddr != "" && other.laddr != laddr {
+			continue
+		}
+		if user != "" && other.user() != user {
+			continue
+		}
+		if clientType != "" && other.clientType() != clientType {
+			continue
+		}
+		if other == c && skipMe {
+			continue
+		}
+		other.kill("killed by client " + strconv.FormatInt(c.id, 10))
+		killed++
+	}
+	return commandResInt(killed)
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"time"
+)
+
+var cronStop chan bool
+
+func StartCron() {
+	cronStop = make(chan bool)
+	go serverCron(cronStop)
+}
+
+func StopCron() {
+	if cronStop != nil {
+		close(cronStop)
+		cronStop = nil
+	}
+}
+
+func cronPeriod() time.Duration {
+	return time.Second / time.Duration(currentConfig().hz)
+}
+
+func serverCron(stop chan bool) {
+	period := cronPeriod()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			clientsCron()
+			activeExpireCycle(period)
+			saveCron()
+			if newPeriod := cronPeriod(); newPeriod != period {
+				period = newPeriod
+				ticker.Reset(period)
+			}
+		}
+	}
+}
+
+func clientsCron() {
+	timeout := time.Duration(currentConfig().timeout) * time.Second
+	if timeout == 0 {
+		return
+	}
+	now := time.Now()
+	for _, c := range clientList() {
+		c.mu.Lock()
+		idle := now.Sub(c.lastInteraction)
+		subscribed := c.proto == protoResp2 && len(c.channels)+len(c.patterns) > 0
+		c.mu.Unlock()
+		if idle > timeout && subscribed == false && c.isBlocked() == false && c.closing.Load() == false {
+			c.kill("idle timeout")
+		}
+	}
+}
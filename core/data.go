@@ -3,6 +3,9 @@ package core
 import (
 	"container/list"
 	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,49 +21,183 @@ type dataNode struct {
 	key         string
 	dataType    int
 	dataPointer interface{}
-	deadTimer   *time.Timer
+	expireAt    time.Time
 }
 
-var dataNodeMap map[string]*dataNode
-var lockSig chan int
+type redisDb struct {
+	id     int
+	shards [dbShardCount]*dbShard
+	// The counters are kept apart from the shards so INFO can read them
+	// without taking any lock.
+	keyCount    atomic.Int64
+	expireCount atomic.Int64
+	// avgTTL is an estimate in milliseconds kept by activeExpireCycle.
+	avgTTL atomic.Int64
+	// watched maps keys to the WATCH entries on them. It stays with the db
+	// on SWAPDB, only the contents move.
+	watchLock  sync.Mutex
+	watched    map[string][]*watchedKey
+	watchCount atomic.Int64
+	// blocking maps keys to the clients blocked on them, under blockLock.
+	blocking map[string][]*blockState
+}
+
+var dbs []*redisDb
 
 func init() {
-	lockSig = make(chan int, 1)
-	dataNodeMap = make(map[string]*dataNode)
+	createDbs(defaultConfig.databases)
+}
+
+func createDbs(count int) {
+	dbs = make([]*redisDb, count)
+	for i := range dbs {
+		dbs[i] = &redisDb{id: i, watched: make(map[string][]*watchedKey), blocking: make(map[string][]*blockState)}
+		for j := range dbs[i].shards {
+			dbs[i].shards[j] = newDbShard()
+		}
+	}
+}
+
+// InitDatabases creates the number of empty databases set by the databases
+// config option.
+func InitDatabases() {
+	keyspaceLock.Lock()
+	defer keyspaceLock.Unlock()
+	createDbs(currentConfig().databases)
+	lastSave.Store(time.Now().Unix())
 }
 
-func lock(_ string) {
-	lockSig <- 1
+func (this *redisDb) shard(key string) *dbShard {
+	return this.shards[shardIndex(key)]
 }
 
-func unlock(_ string) {
-	<-lockSig
+func (this *redisDb) setToDb(key string, node *dataNode) {
+	shard := this.shard(key)
+	old, ex := shard.dict[key]
+	expired := ex && old.expired(now())
+	if ex == false {
+		this.keyCount.Add(1)
+	} else if expired {
+		statExpiredKeys.Add(1)
+		this.notifyKeyspaceEvent(notifyExpired, "expired", key)
+	}
+	shard.dict[key] = node
+	this.indexExpire(shard, key, node)
+	this.signalModifiedKey(key)
+	if ex == false || expired {
+		this.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
 }
 
-func setToDb(key string, node *dataNode) {
-	dataNodeMap[key] = node
+// indexExpire keeps the expires index of a shard in line with the expire time
+// of the node stored under key, a nil node drops the key from it.
+func (this *redisDb) indexExpire(shard *dbShard, key string, node *dataNode) {
+	_, indexed := shard.expires[key]
+	if node != nil && node.expireAt.IsZero() == false {
+		shard.expires[key] = node
+		if indexed == false {
+			this.expireCount.Add(1)
+		}
+	} else if indexed {
+		delete(shard.expires, key)
+		this.expireCount.Add(-1)
+	}
 }
 
-func getFromDb(key string) (*dataNode, bool) {
-	node, ex := dataNodeMap[key]
+// getFromDb treats an expired key as missing but leaves removing it to writes
+// and the active expire cycle, as the shard may only be locked for reading.
+func (this *redisDb) getFromDb(key string) (*dataNode, bool) {
+	node, ex := this.shard(key).dict[key]
+	if ex && node.expired(now()) {
+		return nil, false
+	}
 	return node, ex
 }
 
-func rmFromDb(key string) (*dataNode, bool) {
-	node, ex := dataNodeMap[key]
+func (this *redisDb) rmFromDb(key string) (*dataNode, bool) {
+	node, ex := this.deleteKey(key)
 	if ex {
-		delete(dataNodeMap, key)
+		this.signalModifiedKey(key)
 	}
 	return node, ex
 }
 
-func flushDb() {
-	dataNodeMap = make(map[string]*dataNode)
+func (this *redisDb) deleteKey(key string) (*dataNode, bool) {
+	shard := this.shard(key)
+	node, ex := shard.dict[key]
+	if ex {
+		delete(shard.dict, key)
+		this.keyCount.Add(-1)
+		this.indexExpire(shard, key, nil)
+	}
+	return node, ex
+}
+
+func (this *redisDb) expireKey(key string) {
+	this.deleteKey(key)
+	this.touchWatchedKey(key, true)
+	statExpiredKeys.Add(1)
+	this.notifyKeyspaceEvent(notifyExpired, "expired", key)
+}
+
+func (this *redisDb) flushDb() {
+	this.touchAllWatchedKeys(nil)
+	dirty.Add(this.keyCount.Load())
+	for i := range this.shards {
+		this.shards[i].dict = make(map[string]*dataNode)
+		this.shards[i].expires = make(map[string]*dataNode)
+	}
+	this.keyCount.Store(0)
+	this.expireCount.Store(0)
+	this.avgTTL.Store(0)
+}
+
+// swap exchanges the contents of two dbs, the caller holds keyspaceLock
+// exclusively.
+func (this *redisDb) swap(other *redisDb) {
+	this.touchAllWatchedKeys(other)
+	other.touchAllWatchedKeys(this)
+	this.shards, other.shards = other.shards, this.shards
+	for _, counters := range [][2]*atomic.Int64{
+		{&this.keyCount, &other.keyCount},
+		{&this.expireCount, &other.expireCount},
+		{&this.avgTTL, &other.avgTTL},
+	} {
+		value := counters[0].Load()
+		counters[0].Store(counters[1].Load())
+		counters[1].Store(value)
+	}
+	this.signalBlockedKeys()
+	other.signalBlockedKeys()
+	dirty.Add(1)
+}
+
+// size returns the number of keys and of keys with an expire, including the
+// expired ones not removed yet.
+func (this *redisDb) size() (int, int) {
+	return int(this.keyCount.Load()), int(this.expireCount.Load())
+}
+
+func selectDb(index string) (*redisDb, *cmdResult) {
+	id, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, commandResErrParseInt("value")
+	}
+	if id < 0 || id >= len(dbs) {
+		return nil, commandResErr("ERR DB index is out of range")
+	}
+	return dbs[id], nil
+}
+
+func flushAll() {
+	for _, db := range dbs {
+		db.flushDb()
+	}
 	runtime.GC()
 }
 
-func rmIfEmpty(key string) bool {
-	node, ex := dataNodeMap[key]
+func (this *redisDb) rmIfEmpty(key string) bool {
+	node, ex := this.shard(key).dict[key]
 	if ex == false {
 		return false
 	}
@@ -88,23 +225,125 @@ func rmIfEmpty(key string) bool {
 			return false
 		}
 	}
-	delete(dataNodeMap, key)
+	this.rmFromDb(key)
+	this.notifyKeyspaceEvent(notifyGeneric, "del", key)
 	return true
 }
 
+func (this *dataNode) expired(now time.Time) bool {
+	return this.expireAt.IsZero() == false && this.expireAt.After(now) == false
+}
+
+// setTTL sets the expire time of a node that is not stored yet, setToDb picks
+// it up; nodes already in a db go through setExpire.
 func (this *dataNode) setTTL(ttlMs int) {
-	if ttlMs > 0 {
-		duration := time.Duration(ttlMs * 1e6)
-		if this.deadTimer != nil {
-			this.deadTimer.Stop()
+	if ttlMs <= 0 {
+		this.expireAt = time.Time{}
+		return
+	}
+	this.expireAt = now().Add(time.Duration(ttlMs) * time.Millisecond)
+}
+
+func (this *redisDb) setExpire(node *dataNode, expireAt time.Time) {
+	node.expireAt = expireAt
+	shard := this.shard(node.key)
+	if shard.dict[node.key] == node {
+		this.indexExpire(shard, node.key, node)
+		this.signalModifiedKey(node.key)
+	}
+}
+
+// expireKeys removes every key whose expire time has passed, for clocks that
+// jump instead of ticking. The caller holds keyspaceLock exclusively.
+func expireKeys() int {
+	removed := 0
+	now := now()
+	for _, db := range dbs {
+		for _, shard := range db.shards {
+			for key, node := range shard.expires {
+				if node.expired(now) {
+					db.expireKey(key)
+					removed++
+				}
+			}
 		}
-		this.deadTimer = time.AfterFunc(duration, func() {
-			rmFromDb(this.key)
-		})
-	} else {
-		if this.deadTimer != nil {
-			this.deadTimer.Stop()
+	}
+	return removed
+}
+
+const (
+	activeExpireLookups  = 20
+	activeExpireTimePerc = 25
+)
+
+// expireCursor is the shard, counted across all dbs, the next active expire
+// cycle starts from, so shards after one running out of time are not starved.
+var expireCursor int
+
+// activeExpireCycle samples keys with an expire time in each shard and removes
+// the expired ones, repeating while more than a quarter of a sample was
+// expired and the time budget, a share of the cron period, is not used up.
+// Only one shard is locked at a time, so commands on other keys go on.
+func activeExpireCycle(period time.Duration) {
+	start := time.Now()
+	timeLimit := period * activeExpireTimePerc / 100
+	keyspaceLock.RLock()
+	list := dbs
+	keyspaceLock.RUnlock()
+	total := len(list) * dbShardCount
+	first := expireCursor % total
+	for n := 0; n < total; n++ {
+		pos := (first + n) % total
+		db, i := list[pos/dbShardCount], pos%dbShardCount
+		locks := &keyLocks{write: true, db: db, shards: allShards[i : i+1]}
+		for {
+			locks.lock()
+			shard := db.shards[i]
+			sampled, expired := 0, 0
+			var ttlSum int64
+			now := now()
+			for key, node := range shard.expires {
+				if sampled >= activeExpireLookups {
+					break
+				}
+				sampled++
+				if node.expired(now) {
+					db.expireKey(key)
+					expired++
+				} else {
+					ttlSum += node.expireAt.Sub(now).Milliseconds()
+				}
+			}
+			locks.unlock()
+			if alive := sampled - expired; alive > 0 {
+				avgTTL := db.avgTTL.Load()
+				db.avgTTL.Store(avgTTL/50*49 + ttlSum/int64(alive)/50)
+			}
+			if time.Since(start) > timeLimit {
+				expireCursor = pos + 1
+				statExpiredTimeCapReached.Add(1)
+				return
+			}
+			if sampled == 0 || expired*4 <= sampled {
+				break
+			}
 		}
-		this.deadTimer = nil
+	}
+}
+
+func dataTypeName(dataType int) string {
+	switch dataType {
+	case dataNodeTypeHash:
+		return "hash"
+	case dataNodeTypeList:
+		return "list"
+	case dataNodeTypeSet:
+		return "set"
+	case dataNodeTypeSortedSet:
+		return "zset"
+	case dataNodeTypeString:
+		return "string"
+	default:
+		return "none"
 	}
 }
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestActiveExpireCycleCoversAllDbs(t *testing.T) {
+	session := newTestSession(t)
+	clock := NewManualClock(time.Now())
+	SetClock(clock)
+	for i := range dbs {
+		mustDo(t, session, "SELECT", strconv.Itoa(i))
+		mustDo(t, session, "SET", "key", "value", "PX", "100")
+	}
+	clock.Add(time.Second)
+	// Without a time budget every cycle stops after its first shard.
+	for i := 0; i < len(dbs)*dbShardCount; i++ {
+		activeExpireCycle(0)
+	}
+	for _, db := range dbs {
+		if keys, _ := db.size(); keys != 0 {
+			t.Fatalf("db %d still holds %d expired keys", db.id, keys)
+		}
+	}
+}
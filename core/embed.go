@@ -0,0 +1,341 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ReplyType int
+
+const (
+	ReplyStatus ReplyType = iota + 1
+	ReplyError
+	ReplyNil
+	ReplyString
+	ReplyInt
+	ReplyArray
+	ReplyMap
+	ReplySet
+	ReplyDouble
+	ReplyBool
+	ReplyBigNumber
+	ReplyVerbatim
+	ReplyNullArray
+	ReplyPush
+)
+
+// Reply is a command result handed to in-process callers instead of being
+// encoded as RESP. Maps keep their keys and values as flat pairs in Elems.
+type Reply struct {
+	Type  ReplyType
+	Str   string
+	Int   int64
+	Float float64
+	Elems []*Reply
+}
+
+// ReplyErr is the error returned for error replies, holding the full message
+// including its code, such as "WRONGTYPE ...".
+type ReplyErr string
+
+func (this ReplyErr) Error() string {
+	return string(this)
+}
+
+var ErrNil = errors.New("nil reply")
+
+func newReply(res *cmdResult) *Reply {
+	if res == nil {
+		return nil
+	}
+	reply := &Reply{ReplyType(res.resType), res.resMsg, int64(res.resInt), res.resFloat, nil}
+	if res.resType == resTypeDouble {
+		reply.Str = formatFloat(res.resFloat)
+	}
+	for _, elem := range res.resArray {
+		reply.Elems = append(reply.Elems, newReply(elem))
+	}
+	return reply
+}
+
+func (this *Reply) Err() error {
+	if this != nil && this.Type == ReplyError {
+		return ReplyErr(this.Str)
+	}
+	return nil
+}
+
+func (this *Reply) IsNil() bool {
+	return this == nil || this.Type == ReplyNil || this.Type == ReplyNullArray
+}
+
+func (this *Reply) Text() (string, error) {
+	if err := this.Err(); err != nil {
+		return "", err
+	}
+	if this.IsNil() {
+		return "", ErrNil
+	}
+	switch this.Type {
+	case ReplyInt, ReplyBool:
+		return strconv.FormatInt(this.Int, 10), nil
+	case ReplyArray, ReplyMap, ReplySet, ReplyPush:
+		return "", errors.New("reply is an aggregate")
+	}
+	return this.Str, nil
+}
+
+func (this *Reply) Integer() (int64, error) {
+	if err := this.Err(); err != nil {
+		return 0, err
+	}
+	if this.IsNil() {
+		return 0, ErrNil
+	}
+	switch this.Type {
+	case ReplyInt, ReplyBool:
+		return this.Int, nil
+	case ReplyString, ReplyStatus, ReplyBigNumber:
+		return strconv.ParseInt(this.Str, 10, 64)
+	}
+	return 0, errors.New("reply is not an integer")
+}
+
+func (this *Reply) Double() (float64, error) {
+	if err := this.Err(); err != nil {
+		return 0, err
+	}
+	if this.IsNil() {
+		return 0, ErrNil
+	}
+	switch this.Type {
+	case ReplyDouble:
+		return this.Float, nil
+	case ReplyInt:
+		return float64(this.Int), nil
+	case ReplyString, ReplyStatus:
+		return strconv.ParseFloat(this.Str, 64)
+	}
+	return 0, errors.New("reply is not a number")
+}
+
+// Strings flattens an aggregate reply; nil elements become empty strings.
+func (this *Reply) Strings() ([]string, error) {
+	if err := this.Err(); err != nil {
+		return nil, err
+	}
+	if this.IsNil() {
+		return nil, ErrNil
+	}
+	list := make([]string, len(this.Elems))
+	for i, elem := range this.Elems {
+		if elem.IsNil() {
+			continue
+		}
+		str, err := elem.Text()
+		if err != nil {
+			return nil, err
+		}
+		list[i] = str
+	}
+	return list, nil
+}
+
+func (this *Reply) StringMap() (map[string]string, error) {
+	list, err := this.Strings()
+	if err != nil {
+		return nil, err
+	}
+	if len(list)%2 != 0 {
+		return nil, errors.New("reply has an odd number of elements")
+	}
+	m := make(map[string]string, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		m[list[i]] = list[i+1]
+	}
+	return m, nil
+}
+
+// Session runs commands in process as a client of its own, so state such as
+// the selected protocol or the authenticated user lasts between calls.
+type Session struct {
+	c    *client
+	peer net.Conn
+	mu   sync.Mutex
+}
+
+func NewSession() *Session {
+	conn, peer := net.Pipe()
+	session := &Session{c: newClient(conn), peer: peer}
+	session.c.authenticated = true
+	// Replies come back from Do, output pushed outside of it, such as pubsub
+	// messages, is dropped.
+	go io.Copy(io.Discard, peer)
+	return session
+}
+
+// Do runs one command and returns its reply, or nil for commands that send
+// no reply, such as CLIENT REPLY OFF.
+func (this *Session) Do(args ...string) *Reply {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.do(args...)
+}
+
+// DoContext is Do ending a blocking command once ctx is done. It returns
+// ctx.Err() when the command was cancelled that way, or not run at all as ctx
+// was done before its turn.
+func (this *Session) DoContext(ctx context.Context, args ...string) (*Reply, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	this.c.cancelled = ctx.Done()
+	this.c.blockCancelled = false
+	defer func() {
+		this.c.cancelled = nil
+	}()
+	reply := this.do(args...)
+	if this.c.blockCancelled {
+		return nil, ctx.Err()
+	}
+	return reply, nil
+}
+
+func (this *Session) do(args ...string) *Reply {
+	if len(args) == 0 {
+		return newReply(commandResErr("ERR empty command"))
+	}
+	cmd := &cmd{strings.ToLower(args[0]), args[1:]}
+	if cmd.name == "quit" {
+		return newReply(commandResOk())
+	}
+	this.c.beforeCommand(cmd)
+	return newReply(processCommand(this.c, cmd))
+}
+
+// Close ends a command blocked in Do first, as for a client disconnecting.
+func (this *Session) Close() {
+	this.c.conn.Close()
+	this.peer.Close()
+	this.mu.Lock()
+	this.c.unwatchAllKeys()
+	this.c.unsubscribeAll()
+	this.mu.Unlock()
+	this.c.out.close()
+}
+
+// Reset brings the process-wide server state back to a fresh start: default
+// config, only the default user, an empty keyspace and no pending shutdown.
+func Reset() {
+	configLock.Lock()
+	serverConfig = defaultConfig
+	configLock.Unlock()
+	aclLock.Lock()
+	aclUsers = map[string]*aclUser{"default": newDefaultUser()}
+	aclLock.Unlock()
+	aclLogLock.Lock()
+	aclLogEntries = nil
+	aclLogLock.Unlock()
+	keyspaceLock.Lock()
+	createDbs(defaultConfig.databases)
+	keyspaceLock.Unlock()
+	dirty.Store(0)
+	lastSave.Store(time.Now().Unix())
+	lastSaveFailed.Store(false)
+	SetClock(nil)
+	select {
+	case <-shutdownCh:
+	default:
+	}
+	shuttingDown.Store(false)
+	shutdownNoWait.Store(false)
+}
+
+// KeyInfo is a copy of one key taken for tests inspecting the keyspace.
+// TTL is zero for keys without an expire.
+type KeyInfo struct {
+	Type string
+	TTL  time.Duration
+	Str  string
+	List []string
+	Hash map[string]string
+	Set  []string
+}
+
+// Keys returns the names of every live key in a database, sorted.
+func Keys(db int) []string {
+	keyspaceLock.RLock()
+	defer keyspaceLock.RUnlock()
+	if db < 0 || db >= len(dbs) {
+		return nil
+	}
+	now := now()
+	var keys []string
+	for _, shard := range dbs[db].shards {
+		shard.RLock()
+		for key, node := range shard.dict {
+			if node.expired(now) == false {
+				keys = append(keys, key)
+			}
+		}
+		shard.RUnlock()
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func InspectKey(db int, key string) (KeyInfo, bool) {
+	keyspaceLock.RLock()
+	defer keyspaceLock.RUnlock()
+	if db < 0 || db >= len(dbs) {
+		return KeyInfo{}, false
+	}
+	shard := dbs[db].shard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+	node, ex := dbs[db].getFromDb(key)
+	if ex == false {
+		return KeyInfo{}, false
+	}
+	info := KeyInfo{Type: dataTypeName(node.dataType)}
+	if node.expireAt.IsZero() == false {
+		info.TTL = node.expireAt.Sub(now())
+	}
+	switch data := node.dataPointer.(type) {
+	case string:
+		info.Str = data
+	case *list.List:
+		for e := data.Front(); e != nil; e = e.Next() {
+			info.List = append(info.List, getStringFromElement(e))
+		}
+	case hashNodeData:
+		info.Hash = make(map[string]string, len(data))
+		for field, value := range data {
+			info.Hash[field] = value
+		}
+	case setsNodeData:
+		for member := range data {
+			info.Set = append(info.Set, member)
+		}
+		sort.Strings(info.Set)
+	}
+	return info, true
+}
+
+// ExpireKeys removes the keys whose expire time has passed and returns how
+// many were removed.
+func ExpireKeys() int {
+	keyspaceLock.Lock()
+	defer keyspaceLock.Unlock()
+	return expireKeys()
+}
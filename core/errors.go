@@ -26,3 +26,15 @@ func newCmdError(errorCode int) error {
 	err = cmdError(errorCode)
 	return err
 }
+
+type protocolError string
+
+func (this protocolError) Error() string {
+	return "Protocol error: " + string(this)
+}
+
+func newProtocolError(msg string) error {
+	var err error
+	err = protocolError(msg)
+	return err
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	expireNx = 1
+	expireXx = 2
+	expireGt = 4
+	expireLt = 8
+)
+
+func parseExpireFlags(opt ...string) (int, *cmdResult) {
+	flags := 0
+	for _, option := range opt {
+		switch strings.ToLower(option) {
+		case "nx":
+			flags |= expireNx
+		case "xx":
+			flags |= expireXx
+		case "gt":
+			flags |= expireGt
+		case "lt":
+			flags |= expireLt
+		default:
+			return 0, commandResErr("ERR Unsupported option " + option)
+		}
+	}
+	if flags&expireNx != 0 && flags&(expireXx|expireGt|expireLt) != 0 {
+		return 0, commandResErr("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGt != 0 && flags&expireLt != 0 {
+		return 0, commandResErr("ERR GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// baseExpire sets the expire time of a key, given in units of milliseconds
+// either relative to now or as a unix time. A time in the past deletes the key.
+func baseExpire(db *redisDb, name string, opt []string, unit int64, relative bool) *cmdResult {
+	when, err := strconv.ParseInt(opt[1], 10, 64)
+	if err != nil {
+		return commandResErrParseInt("value")
+	}
+	flags, res := parseExpireFlags(opt[2:]...)
+	if res != nil {
+		return res
+	}
+	if when > math.MaxInt64/unit || when < math.MinInt64/unit {
+		return commandResErr("ERR invalid expire time in '" + name + "' command")
+	}
+	when *= unit
+	now := now()
+	if relative {
+		if when > math.MaxInt64-now.UnixMilli() {
+			return commandResErr("ERR invalid expire time in '" + name + "' command")
+		}
+		when += now.UnixMilli()
+	}
+	node, ex := db.getFromDb(opt[0])
+	if ex == false {
+		return commandResInt(0)
+	}
+	if flags != 0 {
+		hasTTL := node.expireAt.IsZero() == false
+		current := node.expireAt.UnixMilli()
+		if flags&expireNx != 0 && hasTTL {
+			return commandResInt(0)
+		}
+		if flags&expireXx != 0 && hasTTL == false {
+			return commandResInt(0)
+		}
+		if flags&expireGt != 0 && (hasTTL == false || when <= current) {
+			return commandResInt(0)
+		}
+		if flags&expireLt != 0 && hasTTL && when >= current {
+			return commandResInt(0)
+		}
+	}
+	expireAt := time.UnixMilli(when)
+	if expireAt.After(now) == false {
+		baseDel(db, opt[0])
+		db.notifyKeyspaceEvent(notifyGeneric, "del", opt[0])
+		return commandResInt(1)
+	}
+	db.setExpire(node, expireAt)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", opt[0])
+	return commandResInt(1)
+}
+
+func doExpire(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseExpire(db, "expire", opt, 1000, true)
+}
+
+func doPExpire(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseExpire(db, "pexpire", opt, 1, true)
+}
+
+func doExpireAt(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseExpire(db, "expireat", opt, 1000, false)
+}
+
+func doPExpireAt(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseExpire(db, "pexpireat", opt, 1, false)
+}
+
+// baseTTL returns -2 for a missing key, -1 for a key without an expire and
+// otherwise the time left or the expire time, in milliseconds.
+func baseTTL(db *redisDb, key string, absolute bool) int64 {
+	node, ex := db.getFromDb(key)
+	if ex == false {
+		return -2
+	}
+	if node.expireAt.IsZero() {
+		return -1
+	}
+	if absolute {
+		return node.expireAt.UnixMilli()
+	}
+	ttl := node.expireAt.Sub(now()).Milliseconds()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl
+}
+
+func doTTL(c *client, opt ...string) *cmdResult {
+	db := c.db
+	ttl := baseTTL(db, opt[0], false)
+	if ttl < 0 {
+		return commandResInt(int(ttl))
+	}
+	return commandResInt(int((ttl + 500) / 1000))
+}
+
+func doPTTL(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return commandResInt(int(baseTTL(db, opt[0], false)))
+}
+
+func doExpireTime(c *client, opt ...string) *cmdResult {
+	db := c.db
+	at := baseTTL(db, opt[0], true)
+	if at < 0 {
+		return commandResInt(int(at))
+	}
+	return commandResInt(int(at / 1000))
+}
+
+func doPExpireTime(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return commandResInt(int(baseTTL(db, opt[0], true)))
+}
+
+func persistKey(db *redisDb, key string) {
+	if node, ex := db.getFromDb(key); ex && node.expireAt.IsZero() == false {
+		db.setExpire(node, time.Time{})
+	}
+}
+
+func doPersist(c *client, opt ...string) *cmdResult {
+	db := c.db
+	node, ex := db.getFromDb(opt[0])
+	if ex == false || node.expireAt.IsZero() {
+		return commandResInt(0)
+	}
+	db.setExpire(node, time.Time{})
+	db.notifyKeyspaceEvent(notifyGeneric, "persist", opt[0])
+	return commandResInt(1)
+}
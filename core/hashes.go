@@ -15,8 +15,8 @@ func createHashNode(key string) *dataNode {
 	return node
 }
 
-func baseHGetAll(key string) (hashNodeData, *cmdResult) {
-	data, ex := getFromDb(key)
+func baseHGetAll(db *redisDb, key string) (hashNodeData, *cmdResult) {
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeHash {
 			return nil, commandResErrType()
@@ -30,8 +30,8 @@ func baseHGetAll(key string) (hashNodeData, *cmdResult) {
 	}
 }
 
-func baseHSet(key, field, value string) *cmdResult {
-	data, ex := getFromDb(key)
+func baseHSet(db *redisDb, key, field, value string) *cmdResult {
+	data, ex := db.getFromDb(key)
 	var hashNode hashNodeData
 	if ex {
 		if data.dataType != dataNodeTypeHash {
@@ -48,19 +48,19 @@ func baseHSet(key, field, value string) *cmdResult {
 	_, exField := hashNode[field]
 	hashNode[field] = value
 	data.dataPointer = interface{}(hashNode)
-	setToDb(key, data)
+	db.setToDb(key, data)
 	if exField {
 		return commandResInt(0)
 	}
 	return commandResInt(1)
 }
 
-func baseHIncr(key, field, value string) *cmdResult {
+func baseHIncr(db *redisDb, key, field, value string) *cmdResult {
 	delta, err := strconv.Atoi(value)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	hashNode, cmd := baseHGetAll(key)
+	hashNode, cmd := baseHGetAll(db, key)
 	var valueInt int
 	if hashNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
@@ -77,13 +77,15 @@ func baseHIncr(key, field, value string) *cmdResult {
 		valueInt = 0
 	}
 	valueInt = valueInt + delta
-	baseHSet(key, field, strconv.Itoa(valueInt))
+	baseHSet(db, key, field, strconv.Itoa(valueInt))
+	db.notifyKeyspaceEvent(notifyHash, "hincrby", key)
 	return commandResInt(valueInt)
 }
 
-func doHDel(opt ...string) *cmdResult {
+func doHDel(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if dataNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -97,14 +99,19 @@ func doHDel(opt ...string) *cmdResult {
 			count++
 		}
 	}
-	rmIfEmpty(key)
+	if count > 0 {
+		db.signalModifiedKey(key)
+		db.notifyKeyspaceEvent(notifyHash, "hdel", key)
+	}
+	db.rmIfEmpty(key)
 	return commandResInt(count)
 }
 
-func doHExists(opt ...string) *cmdResult {
+func doHExists(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	field := opt[1]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if dataNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -117,10 +124,11 @@ func doHExists(opt ...string) *cmdResult {
 	return commandResInt(0)
 }
 
-func doHGet(opt ...string) *cmdResult {
+func doHGet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	field := opt[1]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if dataNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -133,11 +141,15 @@ func doHGet(opt ...string) *cmdResult {
 	return commandResNil()
 }
 
-func doHGetAll(opt ...string) *cmdResult {
+func doHGetAll(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
-	if cmd != nil {
-		return cmd
+	dataNode, cmd := baseHGetAll(db, key)
+	if dataNode == nil {
+		if cmd != nil && cmd.resType == resTypeFail {
+			return cmd
+		}
+		return commandResMap(nil)
 	}
 	cmdList := make([]*cmdResult, len(dataNode)*2)
 	var i = 0
@@ -147,14 +159,16 @@ func doHGetAll(opt ...string) *cmdResult {
 		cmdList[i] = commandResString(value)
 		i++
 	}
-	return commandResArray(cmdList)
+	return commandResMap(cmdList)
 }
 
-func doHIncrBy(opt ...string) *cmdResult {
-	return baseHIncr(opt[0], opt[1], opt[2])
+func doHIncrBy(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseHIncr(db, opt[0], opt[1], opt[2])
 }
 
-func doHIncrByFloat(opt ...string) *cmdResult {
+func doHIncrByFloat(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	field := opt[1]
 	valueString := opt[2]
@@ -162,7 +176,7 @@ func doHIncrByFloat(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErr("ERR value is not a valid float")
 	}
-	hashNode, cmd := baseHGetAll(key)
+	hashNode, cmd := baseHGetAll(db, key)
 	var valueFloat float64
 	if hashNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
@@ -179,13 +193,15 @@ func doHIncrByFloat(opt ...string) *cmdResult {
 		valueFloat = 0
 	}
 	valueFloat = valueFloat + value
-	baseHSet(key, field, strconv.FormatFloat(valueFloat, 'f', -1, 64))
-	return commandResString(strconv.FormatFloat(valueFloat, 'f', -1, 64))
+	baseHSet(db, key, field, strconv.FormatFloat(valueFloat, 'f', -1, 64))
+	db.notifyKeyspaceEvent(notifyHash, "hincrbyfloat", key)
+	return commandResDouble(valueFloat)
 }
 
-func doHKeys(opt ...string) *cmdResult {
+func doHKeys(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if cmd != nil {
 		return cmd
 	}
@@ -198,9 +214,10 @@ func doHKeys(opt ...string) *cmdResult {
 	return commandResArray(cmdList)
 }
 
-func doHLen(opt ...string) *cmdResult {
+func doHLen(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if cmd != nil {
 		if cmd.resType == resTypeFail {
 			return cmd
@@ -210,10 +227,11 @@ func doHLen(opt ...string) *cmdResult {
 	return commandResInt(len(dataNode))
 }
 
-func doHMGet(opt ...string) *cmdResult {
+func doHMGet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	resList := make([]*cmdResult, len(opt)-1)
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if dataNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -230,43 +248,50 @@ func doHMGet(opt ...string) *cmdResult {
 	return commandResArray(resList)
 }
 
-func doHMSet(opt ...string) *cmdResult {
+func doHMSet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	if len(opt)%2 == 0 {
 		return commandResErr("ERR wrong number of arguments for HMSET")
 	}
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if dataNode == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
 	}
 	for i := 1; i < len(opt); i += 2 {
-		baseHSet(key, opt[i], opt[i+1])
+		baseHSet(db, key, opt[i], opt[i+1])
 	}
+	db.notifyKeyspaceEvent(notifyHash, "hset", key)
 	return commandResOk()
 }
 
-func doHSet(opt ...string) *cmdResult {
+func doHSet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	field := opt[1]
 	value := opt[2]
-	return baseHSet(key, field, value)
+	res := baseHSet(db, key, field, value)
+	if res.resType == resTypeInt {
+		db.notifyKeyspaceEvent(notifyHash, "hset", key)
+	}
+	return res
 }
 
-func doHSetNx(opt ...string) *cmdResult {
-	cmd := doHExists(opt...)
+func doHSetNx(c *client, opt ...string) *cmdResult {
+	cmd := doHExists(c, opt...)
 	if cmd.resType != resTypeInt {
 		return cmd
 	}
 	if cmd.resInt == 1 {
 		return commandResInt(0)
 	}
-	return doHSet(opt...)
+	return doHSet(c, opt...)
 }
 
-func doHStrlen(opt ...string) *cmdResult {
-	cmd := doHGet(opt...)
+func doHStrlen(c *client, opt ...string) *cmdResult {
+	cmd := doHGet(c, opt...)
 	if cmd.resType == resTypeString {
 		return commandResInt(len(cmd.resMsg))
 	} else if cmd.resType == resTypeNil {
@@ -275,9 +300,10 @@ func doHStrlen(opt ...string) *cmdResult {
 	return cmd
 }
 
-func doHVals(opt ...string) *cmdResult {
+func doHVals(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	dataNode, cmd := baseHGetAll(key)
+	dataNode, cmd := baseHGetAll(db, key)
 	if cmd != nil {
 		return cmd
 	}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"container/list"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+func baseDel(db *redisDb, key string) bool {
+	node, ex := db.getFromDb(key)
+	if ex == false {
+		return false
+	}
+	node.setTTL(0)
+	db.rmFromDb(key)
+	return true
+}
+
+func cloneDataNode(node *dataNode, key string) *dataNode {
+	var clone = new(dataNode)
+	clone.key = key
+	clone.dataType = node.dataType
+	switch data := node.dataPointer.(type) {
+	case *list.List:
+		l := list.New()
+		for e := data.Front(); e != nil; e = e.Next() {
+			if member, ok := e.Value.(*sortedSetNode); ok {
+				l.PushBack(&sortedSetNode{member.score, member.member})
+			} else {
+				l.PushBack(e.Value)
+			}
+		}
+		clone.dataPointer = interface{}(l)
+	case hashNodeData:
+		hash := make(hashNodeData, len(data))
+		for field, value := range data {
+			hash[field] = value
+		}
+		clone.dataPointer = interface{}(hash)
+	case setsNodeData:
+		sets := make(setsNodeData, len(data))
+		for member, value := range data {
+			sets[member] = value
+		}
+		clone.dataPointer = interface{}(sets)
+	default:
+		clone.dataPointer = node.dataPointer
+	}
+	clone.expireAt = node.expireAt
+	return clone
+}
+
+func doDel(c *client, opt ...string) *cmdResult {
+	db := c.db
+	deleted := 0
+	for _, key := range opt {
+		if baseDel(db, key) {
+			db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+			deleted++
+		}
+	}
+	return commandResInt(deleted)
+}
+
+func doExists(c *client, opt ...string) *cmdResult {
+	db := c.db
+	count := 0
+	for _, key := range opt {
+		if _, ex := db.getFromDb(key); ex {
+			count++
+		}
+	}
+	return commandResInt(count)
+}
+
+// doTouch only counts the keys, as there is no access time to update.
+func doTouch(c *client, opt ...string) *cmdResult {
+	return doExists(c, opt...)
+}
+
+func doType(c *client, opt ...string) *cmdResult {
+	db := c.db
+	node, ex := db.getFromDb(opt[0])
+	if ex == false {
+		return commandResMsg("none")
+	}
+	return commandResMsg(dataTypeName(node.dataType))
+}
+
+func baseRename(db *redisDb, key, newKey string, nx bool) *cmdResult {
+	node, ex := db.getFromDb(key)
+	if ex == false {
+		return commandResErr("ERR no such key")
+	}
+	if key == newKey {
+		if nx {
+			return commandResInt(0)
+		}
+		return commandResOk()
+	}
+	if _, ex := db.getFromDb(newKey); ex {
+		if nx {
+			return commandResInt(0)
+		}
+		baseDel(db, newKey)
+	}
+	db.rmFromDb(key)
+	node.key = newKey
+	db.setToDb(newKey, node)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_from", key)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_to", newKey)
+	if nx {
+		return commandResInt(1)
+	}
+	return commandResOk()
+}
+
+func doRename(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseRename(db, opt[0], opt[1], false)
+}
+
+func doRenameNx(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseRename(db, opt[0], opt[1], true)
+}
+
+func doKeys(c *client, opt ...string) *cmdResult {
+	db := c.db
+	pattern := opt[0]
+	allKeys := pattern == "*"
+	var resList []*cmdResult
+	for _, shard := range db.shards {
+		for key := range shard.dict {
+			if allKeys == false && stringMatch(pattern, key, false) == false {
+				continue
+			}
+			if _, ex := db.getFromDb(key); ex {
+				resList = append(resList, commandResString(key))
+			}
+		}
+	}
+	return commandResArray(resList)
+}
+
+func doRandomKey(c *client, _ ...string) *cmdResult {
+	db := c.db
+	start := rand.Intn(dbShardCount)
+	for i := 0; i < dbShardCount; i++ {
+		for key := range db.shards[(start+i)%dbShardCount].dict {
+			if _, ex := db.getFromDb(key); ex {
+				return commandResString(key)
+			}
+		}
+	}
+	return commandResNil()
+}
+
+func doDbSize(c *client, _ ...string) *cmdResult {
+	db := c.db
+	keys, _ := db.size()
+	return commandResInt(keys)
+}
+
+func doCopy(c *client, opt ...string) *cmdResult {
+	db := c.db
+	dstDb := db
+	source, destination := opt[0], opt[1]
+	replace := false
+	for i := 2; i < len(opt); i++ {
+		switch strings.ToLower(opt[i]) {
+		case "replace":
+			replace = true
+		case "db":
+			if i+1 >= len(opt) {
+				return commandResErrSyntax()
+			}
+			i++
+			var res *cmdResult
+			if dstDb, res = selectDb(opt[i]); res != nil {
+				return res
+			}
+		default:
+			return commandResErrSyntax()
+		}
+	}
+	if dstDb == db && source == destination {
+		return commandResErr("ERR source and destination objects are the same")
+	}
+	node, ex := db.getFromDb(source)
+	if ex == false {
+		return commandResInt(0)
+	}
+	if _, ex := dstDb.getFromDb(destination); ex {
+		if replace == false {
+			return commandResInt(0)
+		}
+		baseDel(dstDb, destination)
+	}
+	dstDb.setToDb(destination, cloneDataNode(node, destination))
+	dstDb.notifyKeyspaceEvent(notifyGeneric, "copy_to", destination)
+	return commandResInt(1)
+}
+
+func doMove(c *client, opt ...string) *cmdResult {
+	db := c.db
+	dstDb, res := selectDb(opt[1])
+	if res != nil {
+		return res
+	}
+	if dstDb == db {
+		return commandResErr("ERR source and destination objects are the same")
+	}
+	node, ex := db.getFromDb(opt[0])
+	if ex == false {
+		return commandResInt(0)
+	}
+	if _, ex := dstDb.getFromDb(opt[0]); ex {
+		return commandResInt(0)
+	}
+	db.rmFromDb(opt[0])
+	dstDb.setToDb(opt[0], node)
+	db.notifyKeyspaceEvent(notifyGeneric, "move_from", opt[0])
+	dstDb.notifyKeyspaceEvent(notifyGeneric, "move_to", opt[0])
+	return commandResInt(1)
+}
+
+// doSwapDb swaps the contents rather than the redisDb values, so clients that
+// selected either db see the other one's data afterwards.
+func doSwapDb(_ *client, opt ...string) *cmdResult {
+	first, err := strconv.Atoi(opt[0])
+	if err != nil {
+		return commandResErr("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(opt[1])
+	if err != nil {
+		return commandResErr("ERR invalid second DB index")
+	}
+	if first < 0 || first >= len(dbs) || second < 0 || second >= len(dbs) {
+		return commandResErr("ERR DB index is out of range")
+	}
+	dbs[first].swap(dbs[second])
+	return commandResOk()
+}
@@ -22,8 +22,8 @@ func getStringFromElement(e *list.Element) string {
 	return ""
 }
 
-func baseLGet(key string) (*list.List, *cmdResult) {
-	data, ex := getFromDb(key)
+func baseLGet(db *redisDb, key string) (*list.List, *cmdResult) {
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeList {
 			return nil, commandResErrType()
@@ -37,21 +37,215 @@ func baseLGet(key string) (*list.List, *cmdResult) {
 	}
 }
 
-func baseLSet(key string) *list.List {
+func baseLSet(db *redisDb, key string) *list.List {
 	l := list.New()
 	node := createListNode(key, l)
-	setToDb(key, node)
+	db.setToDb(key, node)
 	return l
 }
 
-func doLIndex(opt ...string) *cmdResult {
+// basePop removes the head or the tail of a non-empty list, leaving the key
+// to rmIfEmpty.
+func basePop(db *redisDb, key string, l *list.List, left bool) string {
+	e, event := l.Back(), "rpop"
+	if left {
+		e, event = l.Front(), "lpop"
+	}
+	s := getStringFromElement(e)
+	l.Remove(e)
+	db.signalModifiedKey(key)
+	db.notifyKeyspaceEvent(notifyList, event, key)
+	return s
+}
+
+func baseLPop(db *redisDb, key string, left bool) *cmdResult {
+	l, cmd := baseLGet(db, key)
+	if cmd != nil {
+		return cmd
+	}
+	if l.Len() == 0 {
+		return commandResNil()
+	}
+	s := basePop(db, key, l, left)
+	db.rmIfEmpty(key)
+	return commandResString(s)
+}
+
+// baseLMove pops from source and pushes to destination, the ends given by
+// fromLeft and toLeft.
+func baseLMove(db *redisDb, source, destination string, fromLeft, toLeft bool) *cmdResult {
+	l1, cmd := baseLGet(db, source)
+	if cmd != nil {
+		return cmd
+	}
+	if l1.Len() == 0 {
+		return commandResNil()
+	}
+	l2, cmd := baseLGet(db, destination)
+	if l2 == nil {
+		if cmd != nil && cmd.resType == resTypeFail {
+			return cmd
+		}
+		l2 = baseLSet(db, destination)
+	}
+	s := basePop(db, source, l1, fromLeft)
+	event := "rpush"
+	if toLeft {
+		l2.PushFront(interface{}(s))
+		event = "lpush"
+	} else {
+		l2.PushBack(interface{}(s))
+	}
+	db.signalModifiedKey(destination)
+	db.notifyKeyspaceEvent(notifyList, event, destination)
+	db.rmIfEmpty(source)
+	return commandResString(s)
+}
+
+func parseListEnd(value string) (bool, *cmdResult) {
+	switch strings.ToLower(value) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, commandResErrSyntax()
+}
+
+// baseBPop pops from the first non-empty list of keys, or blocks on all of
+// them. Inside EXEC it never blocks.
+func baseBPop(c *client, keys []string, timeoutStr string, left bool) *cmdResult {
+	timeout, res := parseBlockTimeout(timeoutStr)
+	if res != nil {
+		return res
+	}
+	db := c.db
+	pop := func(key string) *cmdResult {
+		return commandResArray([]*cmdResult{commandResString(key), baseLPop(db, key, left)})
+	}
+	for _, key := range keys {
+		l, cmd := baseLGet(db, key)
+		if l == nil && cmd.resType == resTypeFail {
+			return cmd
+		}
+		if l != nil && l.Len() > 0 {
+			return pop(key)
+		}
+	}
+	if c.inExec {
+		return commandResNullArray()
+	}
+	return blockForKeys(c, keys, "", timeout, commandResNullArray(), pop)
+}
+
+func baseBLMove(c *client, source, destination string, fromLeft, toLeft bool, timeoutStr string) *cmdResult {
+	timeout, res := parseBlockTimeout(timeoutStr)
+	if res != nil {
+		return res
+	}
+	db := c.db
+	res = baseLMove(db, source, destination, fromLeft, toLeft)
+	if res.resType != resTypeNil || c.inExec {
+		return res
+	}
+	return blockForKeys(c, []string{source}, destination, timeout, commandResNil(), func(key string) *cmdResult {
+		return baseLMove(db, key, destination, fromLeft, toLeft)
+	})
+}
+
+func doBLMove(c *client, opt ...string) *cmdResult {
+	fromLeft, res := parseListEnd(opt[2])
+	if res != nil {
+		return res
+	}
+	toLeft, res := parseListEnd(opt[3])
+	if res != nil {
+		return res
+	}
+	return baseBLMove(c, opt[0], opt[1], fromLeft, toLeft, opt[4])
+}
+
+func blmpopKeys(params []string) []string {
+	numKeys, err := strconv.Atoi(params[1])
+	if err != nil || numKeys <= 0 || numKeys > len(params)-2 {
+		return nil
+	}
+	return params[2 : 2+numKeys]
+}
+
+func doBLMPop(c *client, opt ...string) *cmdResult {
+	timeout, res := parseBlockTimeout(opt[0])
+	if res != nil {
+		return res
+	}
+	numKeys, err := strconv.Atoi(opt[1])
+	if err != nil || numKeys <= 0 {
+		return commandResErr("ERR numkeys should be greater than 0")
+	}
+	if numKeys >= len(opt)-2 {
+		return commandResErrSyntax()
+	}
+	keys := opt[2 : 2+numKeys]
+	left, res := parseListEnd(opt[2+numKeys])
+	if res != nil {
+		return res
+	}
+	count := 1
+	switch rest := opt[3+numKeys:]; {
+	case len(rest) == 2 && strings.ToLower(rest[0]) == "count":
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return commandResErr("ERR count should be greater than 0")
+		}
+	case len(rest) != 0:
+		return commandResErrSyntax()
+	}
+	db := c.db
+	pop := func(key string) *cmdResult {
+		l, _ := baseLGet(db, key)
+		var values []*cmdResult
+		for i := 0; i < count && l.Len() > 0; i++ {
+			values = append(values, commandResString(basePop(db, key, l, left)))
+		}
+		db.rmIfEmpty(key)
+		return commandResArray([]*cmdResult{commandResString(key), commandResArray(values)})
+	}
+	for _, key := range keys {
+		l, cmd := baseLGet(db, key)
+		if l == nil && cmd.resType == resTypeFail {
+			return cmd
+		}
+		if l != nil && l.Len() > 0 {
+			return pop(key)
+		}
+	}
+	if c.inExec {
+		return commandResNullArray()
+	}
+	return blockForKeys(c, keys, "", timeout, commandResNullArray(), pop)
+}
+
+func doBLPop(c *client, opt ...string) *cmdResult {
+	return baseBPop(c, opt[:len(opt)-1], opt[len(opt)-1], true)
+}
+
+func doBRPop(c *client, opt ...string) *cmdResult {
+	return baseBPop(c, opt[:len(opt)-1], opt[len(opt)-1], false)
+}
+
+func doBRPopLPush(c *client, opt ...string) *cmdResult {
+	return baseBLMove(c, opt[0], opt[1], false, true, opt[2])
+}
+
+func doLIndex(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	indexStr := opt[1]
 	index, err := strconv.Atoi(indexStr)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -76,7 +270,8 @@ func doLIndex(opt ...string) *cmdResult {
 	return commandResString(getStringFromElement(e))
 }
 
-func doLInsert(opt ...string) *cmdResult {
+func doLInsert(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	pos := strings.ToLower(opt[1])
 	pivot := opt[2]
@@ -84,7 +279,7 @@ func doLInsert(opt ...string) *cmdResult {
 	if pos != "before" && pos != "after" {
 		return commandResErrSyntax()
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -107,14 +302,17 @@ func doLInsert(opt ...string) *cmdResult {
 		} else {
 			l.InsertAfter(interface{}(value), e)
 		}
+		db.signalModifiedKey(key)
+		db.notifyKeyspaceEvent(notifyList, "linsert", key)
 		return commandResInt(l.Len())
 	} else {
 		return commandResInt(-1)
 	}
 }
 
-func doLLen(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
+func doLLen(c *client, opt ...string) *cmdResult {
+	db := c.db
+	l, cmd := baseLGet(db, opt[0])
 	if cmd != nil {
 		if cmd.resType == resTypeFail {
 			return cmd
@@ -125,38 +323,31 @@ func doLLen(opt ...string) *cmdResult {
 	return commandResInt(l.Len())
 }
 
-func doLPop(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
-	if cmd != nil {
-		return cmd
-	}
-	e := l.Front()
-	if e == nil {
-		return commandResNil()
-	}
-	s := getStringFromElement(e)
-	l.Remove(e)
-	rmIfEmpty(opt[0])
-	return commandResString(s)
+func doLPop(c *client, opt ...string) *cmdResult {
+	return baseLPop(c.db, opt[0], true)
 }
 
-func doLPush(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
+func doLPush(c *client, opt ...string) *cmdResult {
+	db := c.db
+	l, cmd := baseLGet(db, opt[0])
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		} else {
-			l = baseLSet(opt[0])
+			l = baseLSet(db, opt[0])
 		}
 	}
 	for _, v := range opt[1:] {
 		l.PushFront(interface{}(v))
 	}
+	db.signalModifiedKey(opt[0])
+	db.notifyKeyspaceEvent(notifyList, "lpush", opt[0])
 	return commandResInt(l.Len())
 }
 
-func doLPushX(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
+func doLPushX(c *client, opt ...string) *cmdResult {
+	db := c.db
+	l, cmd := baseLGet(db, opt[0])
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -165,10 +356,13 @@ func doLPushX(opt ...string) *cmdResult {
 		}
 	}
 	l.PushFront(interface{}(opt[1]))
+	db.signalModifiedKey(opt[0])
+	db.notifyKeyspaceEvent(notifyList, "lpush", opt[0])
 	return commandResInt(l.Len())
 }
 
-func doLRange(opt ...string) *cmdResult {
+func doLRange(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	startStr := opt[1]
 	endStr := opt[2]
@@ -182,7 +376,7 @@ func doLRange(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -220,7 +414,8 @@ func doLRange(opt ...string) *cmdResult {
 	return commandResArray(resList)
 }
 
-func doLRem(opt ...string) *cmdResult {
+func doLRem(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	countStr := opt[1]
 	value := opt[2]
@@ -228,7 +423,7 @@ func doLRem(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -287,10 +482,16 @@ func doLRem(opt ...string) *cmdResult {
 			}
 		}
 	}
+	if totalRm > 0 {
+		db.signalModifiedKey(key)
+		db.notifyKeyspaceEvent(notifyList, "lrem", key)
+		db.rmIfEmpty(key)
+	}
 	return commandResInt(totalRm)
 }
 
-func doLSet(opt ...string) *cmdResult {
+func doLSet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	indexStr := opt[1]
 	value := opt[2]
@@ -298,7 +499,7 @@ func doLSet(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -321,10 +522,13 @@ func doLSet(opt ...string) *cmdResult {
 		e = e.Next()
 	}
 	e.Value = interface{}(value)
+	db.signalModifiedKey(key)
+	db.notifyKeyspaceEvent(notifyList, "lset", key)
 	return commandResOk()
 }
 
-func doLTrim(opt ...string) *cmdResult {
+func doLTrim(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	startStr := opt[1]
 	endStr := opt[2]
@@ -338,7 +542,7 @@ func doLTrim(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	l, cmd := baseLGet(key)
+	l, cmd := baseLGet(db, key)
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -360,7 +564,10 @@ func doLTrim(opt ...string) *cmdResult {
 		end = len - 1
 	}
 	if start > end {
-		rmFromDb(key)
+		db.rmFromDb(key)
+		db.notifyKeyspaceEvent(notifyList, "ltrim", key)
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		return commandResOk()
 	}
 	for i := 0; i < start; i++ {
 		e := l.Front()
@@ -372,66 +579,40 @@ func doLTrim(opt ...string) *cmdResult {
 			l.Remove(e)
 		}
 	}
+	db.signalModifiedKey(key)
+	db.notifyKeyspaceEvent(notifyList, "ltrim", key)
 	return commandResOk()
 }
 
-func doRPop(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
-	if cmd != nil {
-		return cmd
-	}
-	e := l.Back()
-	if e == nil {
-		return commandResNil()
-	}
-	s := getStringFromElement(e)
-	l.Remove(e)
-	rmIfEmpty(opt[0])
-	return commandResString(s)
+func doRPop(c *client, opt ...string) *cmdResult {
+	return baseLPop(c.db, opt[0], false)
 }
 
-func doRPopLPush(opt ...string) *cmdResult {
-	l1, cmd := baseLGet(opt[0])
-	if cmd != nil {
-		return cmd
-	}
-	e := l1.Back()
-	if e == nil {
-		return commandResNil()
-	}
-	s := getStringFromElement(e)
-	var l2 *list.List
-	l2, cmd = baseLGet(opt[1])
-	if l2 == nil {
-		if cmd != nil && cmd.resType == resTypeFail {
-			return cmd
-		} else {
-			l2 = baseLSet(opt[1])
-		}
-	}
-	l2.PushBack(interface{}(s))
-	l1.Remove(e)
-	rmIfEmpty(opt[0])
-	return commandResString(s)
+func doRPopLPush(c *client, opt ...string) *cmdResult {
+	return baseLMove(c.db, opt[0], opt[1], false, true)
 }
 
-func doRPush(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
+func doRPush(c *client, opt ...string) *cmdResult {
+	db := c.db
+	l, cmd := baseLGet(db, opt[0])
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		} else {
-			l = baseLSet(opt[0])
+			l = baseLSet(db, opt[0])
 		}
 	}
 	for _, v := range opt[1:] {
 		l.PushBack(interface{}(v))
 	}
+	db.signalModifiedKey(opt[0])
+	db.notifyKeyspaceEvent(notifyList, "rpush", opt[0])
 	return commandResInt(l.Len())
 }
 
-func doRPushX(opt ...string) *cmdResult {
-	l, cmd := baseLGet(opt[0])
+func doRPushX(c *client, opt ...string) *cmdResult {
+	db := c.db
+	l, cmd := baseLGet(db, opt[0])
 	if l == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -440,5 +621,7 @@ func doRPushX(opt ...string) *cmdResult {
 		}
 	}
 	l.PushBack(interface{}(opt[1]))
+	db.signalModifiedKey(opt[0])
+	db.notifyKeyspaceEvent(notifyList, "rpush", opt[0])
 	return commandResInt(l.Len())
 }
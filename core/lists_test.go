@@ -0,0 +1,54 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBLMPopNumKeysOutOfRange(t *testing.T) {
+	session := newTestSession(t)
+	for _, numKeys := range []string{"9223372036854775807", "2", "-1"} {
+		reply := session.Do("BLMPOP", "0", numKeys, "l", "LEFT")
+		if reply.Err() == nil {
+			t.Fatalf("BLMPOP numkeys %s: want an error, got %+v", numKeys, reply)
+		}
+	}
+	mustDo(t, session, "RPUSH", "l", "a")
+	reply := mustDo(t, session, "BLMPOP", "0", "1", "l", "LEFT")
+	if len(reply.Elems) != 2 || reply.Elems[0].Str != "l" {
+		t.Fatalf("BLMPOP: %+v", reply)
+	}
+	list, err := reply.Elems[1].Strings()
+	if err != nil || strings.Join(list, ",") != "a" {
+		t.Fatalf("BLMPOP: %v %v", list, err)
+	}
+}
+
+func TestLTrimOutOfRange(t *testing.T) {
+	session := newTestSession(t)
+	mustDo(t, session, "RPUSH", "l", "1", "2", "3")
+	mustDo(t, session, "LTRIM", "l", "10", "20")
+	if n, _ := mustDo(t, session, "EXISTS", "l").Integer(); n != 0 {
+		t.Fatalf("LTRIM out of range left the key")
+	}
+	mustDo(t, session, "RPUSH", "l", "1", "2", "3", "4")
+	mustDo(t, session, "LTRIM", "l", "1", "-2")
+	list, _ := mustDo(t, session, "LRANGE", "l", "0", "-1").Strings()
+	if strings.Join(list, ",") != "2,3" {
+		t.Fatalf("LTRIM: %v", list)
+	}
+}
+
+func TestLRemLastElement(t *testing.T) {
+	session := newTestSession(t)
+	mustDo(t, session, "RPUSH", "l", "a", "a")
+	if n, _ := mustDo(t, session, "LREM", "l", "0", "a").Integer(); n != 2 {
+		t.Fatalf("LREM: %d", n)
+	}
+	if n, _ := mustDo(t, session, "EXISTS", "l").Integer(); n != 0 {
+		t.Fatal("LREM left an empty list")
+	}
+	if n, _ := mustDo(t, session, "DBSIZE").Integer(); n != 0 {
+		t.Fatalf("DBSIZE: %d", n)
+	}
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"sort"
+	"sync"
+)
+
+const dbShardCount = 64
+
+// dbShard holds the keys of a db that hash to it, guarded by its own lock.
+type dbShard struct {
+	sync.RWMutex
+	dict map[string]*dataNode
+	// expires indexes the keys of dict that have an expire time.
+	expires map[string]*dataNode
+}
+
+func newDbShard() *dbShard {
+	return &dbShard{dict: make(map[string]*dataNode), expires: make(map[string]*dataNode)}
+}
+
+// keyspaceLock is held shared by everything locking shards and exclusively by
+// what works on several dbs at once or replaces them, so shards are always
+// locked after it.
+var keyspaceLock sync.RWMutex
+
+var allShards []int
+
+func init() {
+	allShards = make([]int, dbShardCount)
+	for i := range allShards {
+		allShards[i] = i
+	}
+}
+
+func shardIndex(key string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash % dbShardCount)
+}
+
+// keyLocks is the set of locks a command runs under. Shards are taken in
+// ascending order, which keeps commands on several keys from deadlocking.
+type keyLocks struct {
+	exclusive bool
+	write     bool
+	db        *redisDb
+	shards    []int
+}
+
+func exclusiveKeyLocks() *keyLocks {
+	return &keyLocks{exclusive: true}
+}
+
+// newKeyLocks locks the shards of the given keys, or every shard of the db
+// when keys is nil.
+func newKeyLocks(db *redisDb, write bool, keys []string) *keyLocks {
+	if keys == nil {
+		return &keyLocks{write: write, db: db, shards: allShards}
+	}
+	shards := make([]int, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, shardIndex(key))
+	}
+	sort.Ints(shards)
+	n := 0
+	for i, shard := range shards {
+		if i == 0 || shard != shards[n-1] {
+			shards[n] = shard
+			n++
+		}
+	}
+	return &keyLocks{write: write, db: db, shards: shards[:n]}
+}
+
+// commandKeyLocks picks the locks of a command from its flags: cmdExclusive
+// ones stop everything else, the others lock the shards of their keys, or the
+// whole db when they take no key, for reading or writing. Commands that are
+// neither reads nor writes do not touch the keyspace and lock nothing.
+func commandKeyLocks(c *client, handler cmdHandler, params []string) *keyLocks {
+	if handler.flags&cmdExclusive != 0 {
+		return exclusiveKeyLocks()
+	}
+	if handler.flags&(cmdRead|cmdWrite) == 0 {
+		return &keyLocks{}
+	}
+	keys := commandKeys(handler, params)
+	if handler.firstKey != 0 && keys == nil {
+		keys = []string{}
+	}
+	return newKeyLocks(c.db, handler.flags&cmdWrite != 0, keys)
+}
+
+func (this *keyLocks) lock() {
+	if this.exclusive {
+		keyspaceLock.Lock()
+		return
+	}
+	if len(this.shards) == 0 {
+		return
+	}
+	keyspaceLock.RLock()
+	for _, i := range this.shards {
+		if this.write {
+			this.db.shards[i].Lock()
+		} else {
+			this.db.shards[i].RLock()
+		}
+	}
+}
+
+func (this *keyLocks) unlock() {
+	if this.exclusive {
+		keyspaceLock.Unlock()
+		return
+	}
+	if len(this.shards) == 0 {
+		return
+	}
+	for i := len(this.shards) - 1; i >= 0; i-- {
+		if this.write {
+			this.db.shards[this.shards[i]].Unlock()
+		} else {
+			this.db.shards[this.shards[i]].RUnlock()
+		}
+	}
+	keyspaceLock.RUnlock()
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func BenchmarkParallelGetSet(b *testing.B) {
+	Reset()
+	var next sync.Mutex
+	id := 0
+	b.RunParallel(func(pb *testing.PB) {
+		session := NewSession()
+		defer session.Close()
+		next.Lock()
+		id++
+		prefix := "key:" + strconv.Itoa(id) + ":"
+		next.Unlock()
+		for i := 0; pb.Next(); i++ {
+			key := prefix + strconv.Itoa(i%1000)
+			session.Do("SET", key, "value")
+			session.Do("GET", key)
+		}
+	})
+}
+
+func TestCrossShardCommandsWithSingleKeyWrites(t *testing.T) {
+	session := newTestSession(t)
+	const rounds = 500
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = "mset:" + strconv.Itoa(i)
+	}
+	var wg sync.WaitGroup
+	run := func(f func(session *Session)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := NewSession()
+			defer session.Close()
+			f(session)
+		}()
+	}
+	errs := make(chan string, 4)
+	run(func(session *Session) {
+		for i := 0; i < rounds; i++ {
+			args := []string{"MSET"}
+			for _, key := range keys {
+				args = append(args, key, strconv.Itoa(i))
+			}
+			session.Do(args...)
+		}
+	})
+	run(func(session *Session) {
+		for i := 0; i < rounds; i++ {
+			values, _ := session.Do(append([]string{"MGET"}, keys...)...).Strings()
+			for _, value := range values {
+				if value != values[0] {
+					errs <- "MGET saw a partial MSET: " + value + " and " + values[0]
+					return
+				}
+			}
+		}
+	})
+	run(func(session *Session) {
+		session.Do("SET", "rename:a", "value")
+		for i := 0; i < rounds; i++ {
+			session.Do("RENAME", "rename:a", "rename:b")
+			session.Do("RENAME", "rename:b", "rename:a")
+		}
+	})
+	for w := 0; w < 4; w++ {
+		run(func(session *Session) {
+			for i := 0; i < rounds; i++ {
+				session.Do("INCR", "counter")
+				session.Do("SET", "single:"+strconv.Itoa(i), "value")
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n, _ := mustDo(t, session, "GET", "counter").Text(); n != strconv.Itoa(4*rounds) {
+		t.Errorf("counter: %s", n)
+	}
+	if n, _ := mustDo(t, session, "EXISTS", "rename:a", "rename:b").Integer(); n != 1 {
+		t.Errorf("renamed keys: %d", n)
+	}
+	if n, _ := mustDo(t, session, "DBSIZE").Integer(); n != int64(len(keys)+2+rounds) {
+		t.Errorf("DBSIZE: %d", n)
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	logDebug   = 0
+	logVerbose = 1
+	logNotice  = 2
+	logWarning = 3
+)
+
+var logLevelNames = []string{"debug", "verbose", "notice", "warning"}
+var logLevelMarks = []string{".", "-", "*", "#"}
+
+var logLock sync.Mutex
+var logOutput io.Writer = os.Stderr
+var logFileHandle *os.File
+
+func OpenLog() error {
+	logLock.Lock()
+	defer logLock.Unlock()
+	path := currentConfig().logFile
+	if path == "" {
+		logOutput = os.Stderr
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if logFileHandle != nil {
+		logFileHandle.Close()
+	}
+	logFileHandle = file
+	logOutput = file
+	return nil
+}
+
+func ReopenLog() error {
+	err := OpenLog()
+	if err != nil {
+		serverLog(logWarning, nil, "Failed to reopen log file: "+err.Error())
+	} else {
+		serverLog(logNotice, nil, "Log file reopened")
+	}
+	return err
+}
+
+func logLevelValue(name string) int {
+	for i, levelName := range logLevelNames {
+		if levelName == name {
+			return i
+		}
+	}
+	return logNotice
+}
+
+func serverLog(level int, c *client, msg string) {
+	conf := currentConfig()
+	if level < logLevelValue(conf.logLevel) {
+		return
+	}
+	now := time.Now()
+	var line string
+	if conf.logFormat == "json" {
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339Nano),
+			"level": logLevelNames[level],
+			"pid":   os.Getpid(),
+			"msg":   msg,
+		}
+		if c != nil {
+			entry["client_id"] = c.id
+			entry["addr"] = c.addr
+		}
+		data, _ := json.Marshal(entry)
+		line = string(data) + "\n"
+	} else {
+		if c != nil {
+			msg = msg + " (id=" + strconv.FormatInt(c.id, 10) + " addr=" + c.addr + ")"
+		}
+		line = strconv.Itoa(os.Getpid()) + ":M " + now.Format("02 Jan 2006 15:04:05.000") + " " + logLevelMarks[level] + " " + msg + "\n"
+	}
+	logLock.Lock()
+	io.WriteString(logOutput, line)
+	logLock.Unlock()
+}
+
+func LogDebug(format string, args ...interface{}) {
+	serverLog(logDebug, nil, fmt.Sprintf(format, args...))
+}
+
+func LogVerbose(format string, args ...interface{}) {
+	serverLog(logVerbose, nil, fmt.Sprintf(format, args...))
+}
+
+func LogNotice(format string, args ...interface{}) {
+	serverLog(logNotice, nil, fmt.Sprintf(format, args...))
+}
+
+func LogWarning(format string, args ...interface{}) {
+	serverLog(logWarning, nil, fmt.Sprintf(format, args...))
+}
@@ -2,92 +2,301 @@ package core
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
+	"errors"
+	"io"
 	"net"
 	"strconv"
 	"strings"
 )
 
 func Handle(conn net.Conn) {
-	var res *cmdResult
+	c := newClient(conn)
+	if err := registerClient(c); err != nil {
+		serverLog(logVerbose, c, "Rejecting client connection: "+err.Error())
+		commandResErr("ERR "+err.Error()).writeTo(c.writer, c.proto)
+		c.close()
+		return
+	}
+	defer unregisterClient(c)
+	defer c.unwatchAllKeys()
+	defer c.unsubscribeAll()
+	c.setKeepAlive(currentConfig().tcpKeepalive)
+	if err := c.tlsHandshake(); err != nil {
+		serverLog(logVerbose, c, "Error accepting a client connection: "+err.Error())
+		c.close()
+		return
+	}
+	aclAuthenticateClient(c)
+	if currentConfig().protectedMode == "yes" && isLocalClient(c) == false && defaultUserHasPassword() == false {
+		serverLog(logVerbose, c, "Denied connection in protected mode")
+		commandResErr("DENIED Redis is running in protected mode because protected mode is enabled and no password is set for the default user. "+
+			"In this mode connections are only accepted from the loopback interface. "+
+			"Set a password with CONFIG SET requirepass or disable protected mode with 'CONFIG SET protected-mode no' from the loopback interface.").writeTo(c.writer, c.proto)
+		c.close()
+		return
+	}
 	for {
-		cmd, err := parse(conn)
+		conf := currentConfig()
+		cmd, err := parse(c.reader, &conf)
 		if err != nil {
-			fmt.Println(err)
-			conn.Close()
+			if shuttingDown.Load() || c.closing.Load() {
+				c.close()
+				return
+			}
+			if _, ok := err.(protocolError); ok {
+				serverLog(logVerbose, c, "Closing client that sent an invalid request: "+err.Error())
+				commandResErr("ERR "+err.Error()).writeTo(c.writer, c.proto)
+			} else {
+				serverLog(logVerbose, c, "Client closed connection")
+			}
+			c.close()
 			return
 		}
+		if cmd == nil {
+			continue
+		}
 		if cmd.name == "quit" {
-			fmt.Println("Close From Client")
-			conn.Close()
+			serverLog(logVerbose, c, "Client closed connection (QUIT)")
+			c.close()
 			return
 		}
-		if handler, ok := commandMap[cmd.name]; ok {
-			paramsCount := len(cmd.params)
-			if handler.argsCount >= 0 && paramsCount != handler.argsCount {
-				res = commandResErrArguments(cmd.name)
-			} else if handler.argsCount < 0 && paramsCount < -1*handler.argsCount {
-				res = commandResErrArguments(cmd.name)
-			} else {
-				lock(cmd.name)
-				res = handler.handler(cmd.params...)
-				unlock(cmd.name)
-			}
-		} else {
-			res = commandResNotFound(cmd.name)
+		c.beforeCommand(cmd)
+		c.writeReply(processCommand(c, cmd))
+		if shuttingDown.Load() || c.closing.Load() {
+			c.close()
+			return
 		}
-		conn.Write([]byte(res.String()))
 	}
 }
 
-func parse(conn net.Conn) (*cmd, error) {
-	buf := bufio.NewReader(conn)
-	cmdLine, err := readLine(buf)
+func processCommand(c *client, cmd *cmd) *cmdResult {
+	handler, ok := commandMap[cmd.name]
+	if ok == false {
+		c.flagTransaction()
+		return commandResNotFound(cmd.name)
+	}
+	argsCount := len(cmd.params) + 1
+	if (handler.argsCount >= 0 && argsCount != handler.argsCount) ||
+		(handler.argsCount < 0 && argsCount < -1*handler.argsCount) {
+		c.flagTransaction()
+		return commandResErrArguments(cmd.name)
+	}
+	if denied := aclCheckCommand(c, cmd.name, handler, cmd.params); denied != nil {
+		c.flagTransaction()
+		return denied
+	}
+	if c.proto == protoResp2 && c.subscriptionCount() > 0 && cmd.name != "ping" && cmd.name != "subscribe" &&
+		cmd.name != "unsubscribe" && cmd.name != "psubscribe" && cmd.name != "punsubscribe" {
+		return commandResErr("ERR Can't execute '" + cmd.name + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+	}
+	if c.multi && handler.flags&cmdNoMulti != 0 {
+		c.flagTransaction()
+		return commandResErr("ERR Command not allowed inside a transaction")
+	}
+	if c.multi && cmd.name != "exec" && cmd.name != "discard" && cmd.name != "multi" && cmd.name != "watch" {
+		c.queueMultiCommand(cmd, handler)
+		return commandResMsg("QUEUED")
+	}
+	statNumCommands.Add(1)
+	locks := commandKeyLocks(c, handler, cmd.params)
+	locks.lock()
+	if shuttingDown.Load() {
+		locks.unlock()
+		return nil
+	}
+	res := handler.handler(c, cmd.params...)
+	locks.unlock()
+	serveBlockedClients()
+	if c.blocked != nil {
+		res = c.waitUnblocked()
+	}
+	return res
+}
+
+func parse(buf *bufio.Reader, conf *config) (*cmd, error) {
+	cmdLine, err := readLine(buf, conf.protoInlineMaxSize)
+	isOneLineType := strings.Index(cmdLine, "*") != 0
+	if err == errLineTooLong {
+		if isOneLineType {
+			return nil, newProtocolError("too big inline request")
+		}
+		return nil, newProtocolError("too big mbulk count string")
+	}
 	if err != nil {
 		return nil, newCmdError(readCmdError)
 	}
-	isOneLineType := strings.Index(cmdLine, "*") != 0
 	var cmdInfo *cmd
 	if isOneLineType {
-		cmdInfo = parseOneLineCmd(cmdLine)
+		cmdInfo, err = parseOneLineCmd(cmdLine)
 	} else {
-		cmdInfo, err = parseMultiLinesCmd(cmdLine, buf)
-		if err != nil {
-			return nil, newCmdError(decodeCmdError)
-		}
+		cmdInfo, err = parseMultiLinesCmd(cmdLine, buf, conf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cmdInfo == nil {
+		return nil, nil
 	}
 	cmdInfo.name = strings.ToLower(cmdInfo.name)
 	return cmdInfo, nil
 }
 
-func parseOneLineCmd(cmdLine string) *cmd {
+func parseOneLineCmd(cmdLine string) (*cmd, error) {
+	infoArr, err := splitArgs(cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(infoArr) == 0 {
+		return nil, nil
+	}
 	var cmdInfo = new(cmd)
-	cmdLine = strings.TrimSpace(cmdLine)
-	infoArr := strings.Split(cmdLine, " ")
 	cmdInfo.name = infoArr[0]
 	cmdInfo.params = infoArr[1:]
-	return cmdInfo
+	return cmdInfo, nil
+}
+
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isArgSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+		var current []byte
+		inQuotes := false
+		inSingleQuotes := false
+		done := false
+		for done == false {
+			if inQuotes {
+				if i >= len(line) {
+					return nil, newProtocolError("unbalanced quotes in request")
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					current = append(current, hexDigitToInt(line[i+2])*16+hexDigitToInt(line[i+3]))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if line[i] == '"' {
+					if i+1 < len(line) && isArgSpace(line[i+1]) == false {
+						return nil, newProtocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else if inSingleQuotes {
+				if i >= len(line) {
+					return nil, newProtocolError("unbalanced quotes in request")
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && isArgSpace(line[i+1]) == false {
+						return nil, newProtocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, line[i])
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', '\v', '\f', 0:
+					done = true
+				case '"':
+					inQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					current = append(current, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, string(current))
+	}
+}
+
+func isArgSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\v' || b == '\f'
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
 }
 
-func parseMultiLinesCmd(startLine string, buf *bufio.Reader) (*cmd, error) {
+func hexDigitToInt(b byte) byte {
+	switch {
+	case b >= '0' && b <= '9':
+		return b - '0'
+	case b >= 'a' && b <= 'f':
+		return b - 'a' + 10
+	default:
+		return b - 'A' + 10
+	}
+}
+
+func parseMultiLinesCmd(startLine string, buf *bufio.Reader, conf *config) (*cmd, error) {
 	argsCount, err := strconv.Atoi(startLine[1:])
-	if err != nil || argsCount == 0 {
-		return nil, newCmdError(decodeCmdError)
+	if err != nil || argsCount > conf.protoMaxMultibulkLen {
+		return nil, newProtocolError("invalid multibulk length")
+	}
+	if argsCount <= 0 {
+		return nil, nil
 	}
-	var list = make([]string, argsCount)
+	var list = make([]string, 0, min(argsCount, 1024))
+	queryLen := int64(len(startLine) + 2)
 	for i := 0; i < argsCount; i++ {
-		line, err := readLine(buf)
+		line, err := readLine(buf, conf.protoInlineMaxSize)
+		if err == errLineTooLong {
+			return nil, newProtocolError("too big bulk count string")
+		}
 		if err != nil {
 			return nil, newCmdError(readCmdError)
 		}
-		if strings.Index(line, "$") != 0 {
-			return nil, newCmdError(decodeCmdError)
+		if len(line) == 0 || line[0] != '$' {
+			got := ""
+			if len(line) > 0 {
+				got = line[:1]
+			}
+			return nil, newProtocolError("expected '$', got '" + got + "'")
+		}
+		bulkLen, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil || bulkLen < 0 || bulkLen > conf.protoMaxBulkLen {
+			return nil, newProtocolError("invalid bulk length")
+		}
+		queryLen += int64(len(line)+2) + bulkLen + 2
+		if queryLen > conf.clientQueryBufferLimit {
+			return nil, newProtocolError("client query buffer limit reached")
 		}
-		line, err = readLine(buf)
+		bulk, err := readBulk(buf, int(bulkLen))
 		if err != nil {
-			return nil, newCmdError(readCmdError)
+			return nil, err
 		}
-		list[i] = line
+		list = append(list, bulk)
 	}
 	var cmdInfo = new(cmd)
 	cmdInfo.name = list[0]
@@ -95,7 +304,22 @@ func parseMultiLinesCmd(startLine string, buf *bufio.Reader) (*cmd, error) {
 	return cmdInfo, nil
 }
 
-func readLine(buf *bufio.Reader) (string, error) {
+func readBulk(buf *bufio.Reader, bulkLen int) (string, error) {
+	var data bytes.Buffer
+	data.Grow(min(bulkLen+2, 1<<20))
+	if _, err := io.CopyN(&data, buf, int64(bulkLen+2)); err != nil {
+		return "", newCmdError(readCmdError)
+	}
+	bulk := data.Bytes()
+	if bulk[bulkLen] != '\r' || bulk[bulkLen+1] != '\n' {
+		return "", newProtocolError("expected CRLF after bulk string")
+	}
+	return string(bulk[:bulkLen]), nil
+}
+
+var errLineTooLong = errors.New("line too long")
+
+func readLine(buf *bufio.Reader, maxLen int) (string, error) {
 	var str []byte
 	for {
 		strTmp, isPrefix, err := buf.ReadLine()
@@ -103,6 +327,9 @@ func readLine(buf *bufio.Reader) (string, error) {
 		if err != nil {
 			return string(str), err
 		}
+		if len(str) > maxLen {
+			return string(str[:1]), errLineTooLong
+		}
 		if isPrefix == false {
 			break
 		}
@@ -0,0 +1,21 @@
+package core
+
+import (
+	"testing"
+)
+
+func newTestSession(t testing.TB) *Session {
+	Reset()
+	session := NewSession()
+	t.Cleanup(session.Close)
+	return session
+}
+
+func mustDo(t testing.TB, session *Session, args ...string) *Reply {
+	t.Helper()
+	reply := session.Do(args...)
+	if err := reply.Err(); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return reply
+}
@@ -0,0 +1,252 @@
+package core
+
+type multiCmd struct {
+	cmd     *cmd
+	handler cmdHandler
+}
+
+func (this *client) queueMultiCommand(cmd *cmd, handler cmdHandler) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.multiQueue = append(this.multiQueue, multiCmd{cmd, handler})
+}
+
+// flagTransaction makes EXEC fail when a command is rejected while queueing.
+func (this *client) flagTransaction() {
+	if this.multi {
+		this.multiAborted = true
+	}
+}
+
+func (this *client) multiCount() int {
+	if this.multi == false {
+		return -1
+	}
+	return len(this.multiQueue)
+}
+
+func (this *client) discardTransaction() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.multi = false
+	this.multiQueue = nil
+	this.multiAborted = false
+}
+
+// transactionKeyLocks merges the locks of the queued commands, so the whole
+// transaction runs under them.
+func transactionKeyLocks(c *client, queue []multiCmd) *keyLocks {
+	write, allKeys := false, false
+	keys := []string{}
+	for _, queued := range queue {
+		cmd, handler := queued.cmd, queued.handler
+		// SELECT moves the following commands to another db.
+		if handler.flags&cmdExclusive != 0 || cmd.name == "select" {
+			return exclusiveKeyLocks()
+		}
+		if handler.flags&(cmdRead|cmdWrite) == 0 {
+			continue
+		}
+		if handler.flags&cmdWrite != 0 {
+			write = true
+		}
+		if handler.firstKey == 0 {
+			allKeys = true
+		} else {
+			keys = append(keys, commandKeys(handler, cmd.params)...)
+		}
+	}
+	// The watched keys are checked for expiry under the same locks.
+	for _, watched := range c.watchedKeys {
+		if watched.db != c.db {
+			return exclusiveKeyLocks()
+		}
+		keys = append(keys, watched.key)
+	}
+	if allKeys {
+		keys = nil
+	}
+	return newKeyLocks(c.db, write, keys)
+}
+
+func doMulti(c *client, _ ...string) *cmdResult {
+	if c.multi {
+		return commandResErr("ERR MULTI calls can not be nested")
+	}
+	c.mu.Lock()
+	c.multi = true
+	c.mu.Unlock()
+	return commandResOk()
+}
+
+func doDiscard(c *client, _ ...string) *cmdResult {
+	if c.multi == false {
+		return commandResErr("ERR DISCARD without MULTI")
+	}
+	c.discardTransaction()
+	c.unwatchAllKeys()
+	return commandResOk()
+}
+
+func doExec(c *client, _ ...string) *cmdResult {
+	if c.multi == false {
+		return commandResErr("ERR EXEC without MULTI")
+	}
+	queue, aborted := c.multiQueue, c.multiAborted
+	c.discardTransaction()
+	if aborted {
+		c.unwatchAllKeys()
+		return commandResErr("EXECABORT Transaction discarded because of previous errors.")
+	}
+	locks := transactionKeyLocks(c, queue)
+	locks.lock()
+	defer locks.unlock()
+	dirty := c.dirtyCAS.Load() || c.watchedKeyExpired()
+	c.unwatchAllKeys()
+	if dirty {
+		return commandResNullArray()
+	}
+	replies := make([]*cmdResult, 0, len(queue))
+	c.inExec = true
+	defer func() { c.inExec = false }()
+	for _, queued := range queue {
+		if shuttingDown.Load() {
+			break
+		}
+		cmd, handler := queued.cmd, queued.handler
+		// The ACL may have changed since the command was queued.
+		if denied := aclCheckCommand(c, cmd.name, handler, cmd.params); denied != nil {
+			replies = append(replies, denied)
+			continue
+		}
+		statNumCommands.Add(1)
+		replies = append(replies, handler.handler(c, cmd.params...))
+	}
+	return commandResArray(replies)
+}
+
+type watchedKey struct {
+	client *client
+	db     *redisDb
+	key    string
+	// expired is set when the key was already expired at WATCH time, so its
+	// removal by expiry is not a change.
+	expired bool
+}
+
+// watchKey needs the shard of the key locked.
+func (this *client) watchKey(key string) {
+	for _, watched := range this.watchedKeys {
+		if watched.db == this.db && watched.key == key {
+			return
+		}
+	}
+	node, ex := this.db.shard(key).dict[key]
+	watched := &watchedKey{this, this.db, key, ex && node.expired(now())}
+	db := this.db
+	db.watchLock.Lock()
+	db.watched[key] = append(db.watched[key], watched)
+	db.watchCount.Add(1)
+	db.watchLock.Unlock()
+	this.watchedKeys = append(this.watchedKeys, watched)
+}
+
+func (this *client) unwatchAllKeys() {
+	for _, watched := range this.watchedKeys {
+		db := watched.db
+		db.watchLock.Lock()
+		list := db.watched[watched.key]
+		for i, item := range list {
+			if item == watched {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(db.watched, watched.key)
+		} else {
+			db.watched[watched.key] = list
+		}
+		db.watchCount.Add(-1)
+		db.watchLock.Unlock()
+	}
+	this.watchedKeys = nil
+	this.dirtyCAS.Store(false)
+}
+
+// watchedKeyExpired reports whether a watched key expired after WATCH while
+// nothing removed it yet. The shards of the keys must be locked.
+func (this *client) watchedKeyExpired() bool {
+	now := now()
+	for _, watched := range this.watchedKeys {
+		if watched.expired {
+			continue
+		}
+		if node, ex := watched.db.shard(watched.key).dict[watched.key]; ex && node.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// signalModifiedKey is called on every change of a key, with its shard locked
+// for writing, and makes the EXEC of the clients watching it fail.
+func (this *redisDb) signalModifiedKey(key string) {
+	dirty.Add(1)
+	this.touchWatchedKey(key, false)
+	this.signalKeyAsReady(key)
+}
+
+func (this *redisDb) touchWatchedKey(key string, expired bool) {
+	if this.watchCount.Load() == 0 {
+		return
+	}
+	this.watchLock.Lock()
+	defer this.watchLock.Unlock()
+	for _, watched := range this.watched[key] {
+		if expired && watched.expired {
+			continue
+		}
+		watched.client.dirtyCAS.Store(true)
+	}
+}
+
+// touchAllWatchedKeys marks the watchers of the keys found in this db or in
+// other, for commands replacing the contents of whole dbs.
+func (this *redisDb) touchAllWatchedKeys(other *redisDb) {
+	if this.watchCount.Load() == 0 {
+		return
+	}
+	this.watchLock.Lock()
+	defer this.watchLock.Unlock()
+	for key, list := range this.watched {
+		_, ex := this.shard(key).dict[key]
+		if ex == false && other != nil {
+			_, ex = other.shard(key).dict[key]
+		}
+		if ex == false {
+			continue
+		}
+		for _, watched := range list {
+			watched.client.dirtyCAS.Store(true)
+		}
+	}
+}
+
+func doWatch(c *client, opt ...string) *cmdResult {
+	if c.multi {
+		return commandResErr("ERR WATCH inside MULTI is not allowed")
+	}
+	locks := newKeyLocks(c.db, false, opt)
+	locks.lock()
+	defer locks.unlock()
+	for _, key := range opt {
+		c.watchKey(key)
+	}
+	return commandResOk()
+}
+
+func doUnwatch(c *client, _ ...string) *cmdResult {
+	c.unwatchAllKeys()
+	return commandResOk()
+}
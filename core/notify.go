@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	notifyKeyspace = 1 << iota
+	notifyKeyevent
+	notifyGeneric
+	notifyString
+	notifyList
+	notifySet
+	notifyHash
+	notifyZset
+	notifyExpired
+	notifyEvicted
+	notifyStream
+	notifyKeyMiss
+	notifyModule
+	notifyNew
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZset |
+		notifyExpired | notifyEvicted | notifyStream | notifyModule
+)
+
+var notifyClasses = []struct {
+	flag  byte
+	class int
+}{
+	{'g', notifyGeneric}, {'$', notifyString}, {'l', notifyList}, {'s', notifySet}, {'h', notifyHash},
+	{'z', notifyZset}, {'x', notifyExpired}, {'e', notifyEvicted}, {'t', notifyStream}, {'d', notifyModule},
+	{'K', notifyKeyspace}, {'E', notifyKeyevent}, {'m', notifyKeyMiss}, {'n', notifyNew},
+}
+
+func parseKeyspaceEvents(value string) (int, error) {
+	classes := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == 'A' {
+			classes |= notifyAll
+			continue
+		}
+		found := false
+		for _, item := range notifyClasses {
+			if item.flag == value[i] {
+				classes |= item.class
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return 0, errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		}
+	}
+	return classes, nil
+}
+
+func keyspaceEventsString(classes int) string {
+	flags := ""
+	if classes&notifyAll == notifyAll {
+		flags = "A"
+	}
+	for _, item := range notifyClasses {
+		if flags == "A" && item.class&notifyAll != 0 {
+			continue
+		}
+		if classes&item.class != 0 {
+			flags += string(item.flag)
+		}
+	}
+	return flags
+}
+
+// notifyKeyspaceEvent publishes an event of the given class on key to the
+// __keyspace@<db>__:<key> and __keyevent@<db>__:<event> channels, as enabled
+// by notify-keyspace-events. It is called with the shard of the key locked.
+func (this *redisDb) notifyKeyspaceEvent(class int, event, key string) {
+	configLock.RLock()
+	classes := serverConfig.notifyKeyspaceEvents
+	configLock.RUnlock()
+	if classes&class == 0 {
+		return
+	}
+	id := strconv.Itoa(this.id)
+	if classes&notifyKeyspace != 0 {
+		publish("__keyspace@"+id+"__:"+key, event)
+	}
+	if classes&notifyKeyevent != 0 {
+		publish("__keyevent@"+id+"__:"+event, key)
+	}
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// dirty counts the changes to the keyspace since the last save, lastSave and
+// lastSaveTry are unix times, for the save points.
+var dirty atomic.Int64
+var lastSave atomic.Int64
+var lastSaveTry atomic.Int64
+var lastSaveFailed atomic.Bool
+
+type snapshotEntry struct {
+	Db       int
+	Key      string
+	Type     int
+	Str      string
+	Elements []string
+	Fields   map[string]string
+	ExpireAt int64
+}
+
+func dbFilePath() string {
+	conf := currentConfig()
+	return filepath.Join(conf.dir, conf.dbFilename)
+}
+
+func newSnapshotEntry(db int, key string, node *dataNode) (snapshotEntry, bool) {
+	entry := snapshotEntry{Db: db, Key: key, Type: node.dataType}
+	if node.expireAt.IsZero() == false {
+		entry.ExpireAt = node.expireAt.UnixMilli()
+	}
+	switch node.dataType {
+	case dataNodeTypeString:
+		entry.Str, _ = node.dataPointer.(string)
+	case dataNodeTypeList:
+		if l, ok := node.dataPointer.(*list.List); ok {
+			for e := l.Front(); e != nil; e = e.Next() {
+				entry.Elements = append(entry.Elements, getStringFromElement(e))
+			}
+		}
+	case dataNodeTypeHash:
+		if h, ok := node.dataPointer.(hashNodeData); ok {
+			entry.Fields = map[string]string(h)
+		}
+	case dataNodeTypeSet:
+		if s, ok := node.dataPointer.(setsNodeData); ok {
+			for member := range s {
+				entry.Elements = append(entry.Elements, member)
+			}
+		}
+	default:
+		return entry, false
+	}
+	return entry, true
+}
+
+func saveDb() error {
+	var entries []snapshotEntry
+	now := now()
+	for _, db := range dbs {
+		for _, shard := range db.shards {
+			for key, node := range shard.dict {
+				if node.expired(now) {
+					continue
+				}
+				if entry, ok := newSnapshotEntry(db.id, key, node); ok {
+					entries = append(entries, entry)
+				}
+			}
+		}
+	}
+	path := dbFilePath()
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(file)
+	err = gob.NewEncoder(buf).Encode(entries)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	dirty.Store(0)
+	lastSave.Store(time.Now().Unix())
+	serverLog(logNotice, nil, "DB saved on disk")
+	return nil
+}
+
+// saveCron saves the keyspace once one of the save points is reached, a
+// failed save is retried after 5 seconds.
+func saveCron() {
+	params := strings.Fields(currentConfig().save)
+	changes := dirty.Load()
+	now := time.Now().Unix()
+	if lastSaveFailed.Load() && now-lastSaveTry.Load() < 5 {
+		return
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		seconds, _ := strconv.ParseInt(params[i], 10, 64)
+		minChanges, _ := strconv.ParseInt(params[i+1], 10, 64)
+		if changes < minChanges || now-lastSave.Load() <= seconds {
+			continue
+		}
+		serverLog(logNotice, nil, params[i+1]+" changes in "+params[i]+" seconds. Saving...")
+		locks := exclusiveKeyLocks()
+		locks.lock()
+		err := saveDb()
+		locks.unlock()
+		lastSaveTry.Store(now)
+		lastSaveFailed.Store(err != nil)
+		if err != nil {
+			serverLog(logWarning, nil, "Error trying to save the DB: "+err.Error())
+		}
+		return
+	}
+}
+
+func LoadData() error {
+	file, err := os.Open(dbFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	var entries []snapshotEntry
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&entries); err != nil {
+		return err
+	}
+	keyspaceLock.Lock()
+	defer keyspaceLock.Unlock()
+	now := now().UnixMilli()
+	for _, entry := range entries {
+		if entry.Db < 0 || entry.Db >= len(dbs) {
+			return errors.New("DB index " + strconv.Itoa(entry.Db) + " is out of range, check the databases option")
+		}
+		ttlMs := 0
+		if entry.ExpireAt > 0 {
+			ttlMs = int(entry.ExpireAt - now)
+			if ttlMs <= 0 {
+				continue
+			}
+		}
+		var node *dataNode
+		switch entry.Type {
+		case dataNodeTypeString:
+			node = createStringNode(entry.Key, entry.Str, 0)
+		case dataNodeTypeList:
+			l := list.New()
+			for _, element := range entry.Elements {
+				l.PushBack(interface{}(element))
+			}
+			node = createListNode(entry.Key, l)
+		case dataNodeTypeHash:
+			node = createHashNode(entry.Key)
+			node.dataPointer = interface{}(hashNodeData(entry.Fields))
+		case dataNodeTypeSet:
+			sets := make(setsNodeData)
+			for _, member := range entry.Elements {
+				sets[member] = member
+			}
+			node = createSetsNode(entry.Key)
+			node.dataPointer = interface{}(sets)
+		default:
+			continue
+		}
+		node.setTTL(ttlMs)
+		dbs[entry.Db].setToDb(entry.Key, node)
+	}
+	serverLog(logNotice, nil, "DB loaded from disk: "+strconv.Itoa(len(entries))+" keys")
+	return nil
+}
+
+func doSave(_ *client, _ ...string) *cmdResult {
+	if err := saveDb(); err != nil {
+		return commandResErr("ERR " + err.Error())
+	}
+	return commandResOk()
+}
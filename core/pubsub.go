@@ -0,0 +1,218 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pubsubOutputLimit is the output a subscriber may leave unread before it is
+// disconnected, as with the pubsub class of client-output-buffer-limit.
+const pubsubOutputLimit = 32 * 1024 * 1024
+
+var pubsubChannels = make(map[string]map[*client]bool)
+var pubsubPatterns = make(map[string]map[*client]bool)
+var pubsubLock sync.RWMutex
+
+func (this *client) subscriptionCount() int {
+	return len(this.channels) + len(this.patterns)
+}
+
+// push writes a reply outside of the request and reply flow, for messages to
+// subscribers and for commands answering with several replies. flush hands it
+// to the output at once, for clients other than the running one.
+func (this *client) push(res *cmdResult, flush bool) {
+	this.mu.Lock()
+	proto := this.proto
+	this.mu.Unlock()
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	res.writeTo(this.writer, proto)
+	if flush {
+		this.writer.Flush()
+	}
+}
+
+func (this *client) deliver(res *cmdResult) {
+	if this.closing.Load() {
+		return
+	}
+	this.push(res, true)
+	if this.out.size() > pubsubOutputLimit {
+		this.out.abort(errors.New("output buffer limit reached"))
+		this.kill("pubsub output buffer limit reached")
+	}
+}
+
+func pubsubReply(kind string, name *cmdResult, count int) *cmdResult {
+	return commandResPush([]*cmdResult{commandResString(kind), name, commandResInt(count)})
+}
+
+func (this *client) subscribe(channels map[string]bool, subscribers map[string]map[*client]bool, name string) bool {
+	if channels[name] {
+		return false
+	}
+	this.mu.Lock()
+	channels[name] = true
+	this.mu.Unlock()
+	if subscribers[name] == nil {
+		subscribers[name] = make(map[*client]bool)
+	}
+	subscribers[name][this] = true
+	return true
+}
+
+func (this *client) unsubscribe(channels map[string]bool, subscribers map[string]map[*client]bool, name string) bool {
+	if channels[name] == false {
+		return false
+	}
+	this.mu.Lock()
+	delete(channels, name)
+	this.mu.Unlock()
+	delete(subscribers[name], this)
+	if len(subscribers[name]) == 0 {
+		delete(subscribers, name)
+	}
+	return true
+}
+
+func (this *client) unsubscribeAll() {
+	pubsubLock.Lock()
+	defer pubsubLock.Unlock()
+	for channel := range this.channels {
+		this.unsubscribe(this.channels, pubsubChannels, channel)
+	}
+	for pattern := range this.patterns {
+		this.unsubscribe(this.patterns, pubsubPatterns, pattern)
+	}
+}
+
+func baseSubscribe(c *client, kind string, names []string) *cmdResult {
+	pattern := kind == "psubscribe"
+	if denied := aclCheckChannels(c, names, pattern); denied != nil {
+		return denied
+	}
+	channels, subscribers := c.channels, pubsubChannels
+	if pattern {
+		channels, subscribers = c.patterns, pubsubPatterns
+	}
+	var replies []*cmdResult
+	pubsubLock.Lock()
+	for _, name := range names {
+		c.subscribe(channels, subscribers, name)
+		replies = append(replies, pubsubReply(kind, commandResString(name), c.subscriptionCount()))
+	}
+	pubsubLock.Unlock()
+	for _, reply := range replies {
+		c.push(reply, false)
+	}
+	return nil
+}
+
+func baseUnsubscribe(c *client, kind string, names []string) *cmdResult {
+	channels, subscribers := c.channels, pubsubChannels
+	if kind == "punsubscribe" {
+		channels, subscribers = c.patterns, pubsubPatterns
+	}
+	var replies []*cmdResult
+	pubsubLock.Lock()
+	if len(names) == 0 {
+		for name := range channels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			replies = append(replies, pubsubReply(kind, commandResNil(), c.subscriptionCount()))
+		}
+	}
+	for _, name := range names {
+		c.unsubscribe(channels, subscribers, name)
+		replies = append(replies, pubsubReply(kind, commandResString(name), c.subscriptionCount()))
+	}
+	pubsubLock.Unlock()
+	for _, reply := range replies {
+		c.push(reply, false)
+	}
+	return nil
+}
+
+func doSubscribe(c *client, opt ...string) *cmdResult {
+	return baseSubscribe(c, "subscribe", opt)
+}
+
+func doPSubscribe(c *client, opt ...string) *cmdResult {
+	return baseSubscribe(c, "psubscribe", opt)
+}
+
+func doUnsubscribe(c *client, opt ...string) *cmdResult {
+	return baseUnsubscribe(c, "unsubscribe", opt)
+}
+
+func doPUnsubscribe(c *client, opt ...string) *cmdResult {
+	return baseUnsubscribe(c, "punsubscribe", opt)
+}
+
+// publish sends a message to the subscribers of the channel and of the
+// patterns matching it, and returns how many received it.
+func publish(channel, message string) int {
+	pubsubLock.RLock()
+	defer pubsubLock.RUnlock()
+	receivers := 0
+	if subscribers := pubsubChannels[channel]; len(subscribers) > 0 {
+		msg := commandResPush(commandResStrings([]string{"message", channel, message}))
+		for subscriber := range subscribers {
+			subscriber.deliver(msg)
+			receivers++
+		}
+	}
+	for pattern, subscribers := range pubsubPatterns {
+		if stringMatch(pattern, channel, false) == false {
+			continue
+		}
+		msg := commandResPush(commandResStrings([]string{"pmessage", pattern, channel, message}))
+		for subscriber := range subscribers {
+			subscriber.deliver(msg)
+			receivers++
+		}
+	}
+	return receivers
+}
+
+func doPublish(c *client, opt ...string) *cmdResult {
+	if denied := aclCheckChannels(c, opt[:1], false); denied != nil {
+		return denied
+	}
+	return commandResInt(publish(opt[0], opt[1]))
+}
+
+func doPubSub(_ *client, opt ...string) *cmdResult {
+	pubsubLock.RLock()
+	defer pubsubLock.RUnlock()
+	switch strings.ToLower(opt[0]) {
+	case "channels":
+		if len(opt) > 2 {
+			return commandResErrArguments("pubsub|channels")
+		}
+		var channels []string
+		for channel := range pubsubChannels {
+			if len(opt) == 1 || stringMatch(opt[1], channel, false) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		return commandResArray(commandResStrings(channels))
+	case "numsub":
+		var resList []*cmdResult
+		for _, channel := range opt[1:] {
+			resList = append(resList, commandResString(channel), commandResInt(len(pubsubChannels[channel])))
+		}
+		return commandResArray(resList)
+	case "numpat":
+		if len(opt) != 1 {
+			return commandResErrArguments("pubsub|numpat")
+		}
+		return commandResInt(len(pubsubPatterns))
+	}
+	return commandResErr("ERR unknown subcommand '" + opt[0] + "'. Try PUBSUB HELP.")
+}
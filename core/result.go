@@ -1,68 +1,143 @@
 package core
 
 import (
-	"bytes"
+	"bufio"
+	"math"
 	"strconv"
 )
 
 const (
-	resTypeMsg    = 1
-	resTypeFail   = 2
-	resTypeNil    = 3
-	resTypeString = 4
-	resTypeInt    = 5
-	resTypeArray  = 6
+	resTypeMsg       = 1
+	resTypeFail      = 2
+	resTypeNil       = 3
+	resTypeString    = 4
+	resTypeInt       = 5
+	resTypeArray     = 6
+	resTypeMap       = 7
+	resTypeSet       = 8
+	resTypeDouble    = 9
+	resTypeBool      = 10
+	resTypeBigNumber = 11
+	resTypeVerbatim  = 12
+	resTypeNullArray = 13
+	resTypePush      = 14
+)
+
+const (
+	protoResp2 = 2
+	protoResp3 = 3
 )
 
 type cmdResult struct {
 	resType  int
 	resMsg   string
 	resInt   int
+	resFloat float64
 	resArray []*cmdResult
 }
 
-func (this *cmdResult) String() string {
-	var str string
+func (this *cmdResult) writeTo(w *bufio.Writer, proto int) {
 	switch this.resType {
 	case resTypeMsg:
-		buf := bytes.Buffer{}
-		buf.WriteString("+")
-		buf.WriteString(this.resMsg)
-		buf.WriteString("\r\n")
-		str = buf.String()
+		writeLine(w, '+', this.resMsg)
 	case resTypeFail:
-		buf := bytes.Buffer{}
-		buf.WriteString("-")
-		buf.WriteString(this.resMsg)
-		buf.WriteString("\r\n")
-		str = buf.String()
+		writeLine(w, '-', this.resMsg)
 	case resTypeNil:
-		str = "$-1\r\n"
+		if proto == protoResp3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case resTypeNullArray:
+		if proto == protoResp3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("*-1\r\n")
+		}
 	case resTypeString:
-		buf := bytes.Buffer{}
-		buf.WriteString("$")
-		buf.WriteString(strconv.Itoa(len(this.resMsg)))
-		buf.WriteString("\r\n")
-		buf.WriteString(this.resMsg)
-		buf.WriteString("\r\n")
-		str = buf.String()
+		writeBulk(w, '$', this.resMsg)
 	case resTypeInt:
-		buf := bytes.Buffer{}
-		buf.WriteString(":")
-		buf.WriteString(strconv.Itoa(this.resInt))
-		buf.WriteString("\r\n")
-		str = buf.String()
-	case resTypeArray:
-		buf := bytes.Buffer{}
-		buf.WriteString("*")
-		buf.WriteString(strconv.Itoa(len(this.resArray)))
-		buf.WriteString("\r\n")
+		writeLength(w, ':', this.resInt)
+	case resTypeDouble:
+		if proto == protoResp3 {
+			writeLine(w, ',', formatFloat(this.resFloat))
+		} else {
+			writeBulk(w, '$', formatFloat(this.resFloat))
+		}
+	case resTypeBool:
+		if proto == protoResp3 {
+			if this.resInt != 0 {
+				w.WriteString("#t\r\n")
+			} else {
+				w.WriteString("#f\r\n")
+			}
+		} else {
+			writeLength(w, ':', this.resInt)
+		}
+	case resTypeBigNumber:
+		if proto == protoResp3 {
+			writeLine(w, '(', this.resMsg)
+		} else {
+			writeBulk(w, '$', this.resMsg)
+		}
+	case resTypeVerbatim:
+		if proto == protoResp3 {
+			writeLength(w, '=', len(this.resMsg)+4)
+			w.WriteString("txt:")
+			w.WriteString(this.resMsg)
+			w.WriteString("\r\n")
+		} else {
+			writeBulk(w, '$', this.resMsg)
+		}
+	case resTypeArray, resTypeMap, resTypeSet, resTypePush:
+		size := len(this.resArray)
+		var prefix byte = '*'
+		if proto == protoResp3 {
+			switch this.resType {
+			case resTypeMap:
+				prefix = '%'
+				size = size / 2
+			case resTypeSet:
+				prefix = '~'
+			case resTypePush:
+				prefix = '>'
+			}
+		}
+		writeLength(w, prefix, size)
 		for _, data := range this.resArray {
-			buf.WriteString(data.String())
+			data.writeTo(w, proto)
 		}
-		str = buf.String()
 	}
-	return str
+}
+
+func writeLine(w *bufio.Writer, prefix byte, data string) {
+	w.WriteByte(prefix)
+	w.WriteString(data)
+	w.WriteString("\r\n")
+}
+
+func writeLength(w *bufio.Writer, prefix byte, length int) {
+	w.WriteByte(prefix)
+	w.Write(strconv.AppendInt(w.AvailableBuffer(), int64(length), 10))
+	w.WriteString("\r\n")
+}
+
+func writeBulk(w *bufio.Writer, prefix byte, data string) {
+	writeLength(w, prefix, len(data))
+	w.WriteString(data)
+	w.WriteString("\r\n")
+}
+
+func formatFloat(data float64) string {
+	switch {
+	case math.IsInf(data, 1):
+		return "inf"
+	case math.IsInf(data, -1):
+		return "-inf"
+	case math.IsNaN(data):
+		return "nan"
+	}
+	return strconv.FormatFloat(data, 'f', -1, 64)
 }
 
 func commandResOk() *cmdResult {
@@ -72,6 +147,13 @@ func commandResOk() *cmdResult {
 	return res
 }
 
+func commandResMsg(msg string) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeMsg
+	res.resMsg = msg
+	return res
+}
+
 func commandResNil() *cmdResult {
 	res := new(cmdResult)
 	res.resType = resTypeNil
@@ -81,6 +163,12 @@ func commandResNil() *cmdResult {
 	return res
 }
 
+func commandResNullArray() *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeNullArray
+	return res
+}
+
 func commandResString(data string) *cmdResult {
 	res := new(cmdResult)
 	res.resType = resTypeString
@@ -95,6 +183,36 @@ func commandResInt(data int) *cmdResult {
 	return res
 }
 
+func commandResDouble(data float64) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeDouble
+	res.resFloat = data
+	return res
+}
+
+func commandResBool(data bool) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeBool
+	if data {
+		res.resInt = 1
+	}
+	return res
+}
+
+func commandResBigNumber(data string) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeBigNumber
+	res.resMsg = data
+	return res
+}
+
+func commandResVerbatim(data string) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeVerbatim
+	res.resMsg = data
+	return res
+}
+
 func commandResArray(data []*cmdResult) *cmdResult {
 	res := new(cmdResult)
 	res.resType = resTypeArray
@@ -106,6 +224,27 @@ func commandResEmptyArray() *cmdResult {
 	return commandResArray(nil)
 }
 
+func commandResMap(data []*cmdResult) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeMap
+	res.resArray = data
+	return res
+}
+
+func commandResSet(data []*cmdResult) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypeSet
+	res.resArray = data
+	return res
+}
+
+func commandResPush(data []*cmdResult) *cmdResult {
+	res := new(cmdResult)
+	res.resType = resTypePush
+	res.resArray = data
+	return res
+}
+
 func commandResNotFound(name string) *cmdResult {
 	return commandResErr("ERR unknown command '" + name + "'")
 }
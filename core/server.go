@@ -1,10 +1,133 @@
 package core
 
-func doFlushAll(_ ...string) *cmdResult {
-	flushDb()
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	serverName    = "redis"
+	serverVersion = "6.2.0"
+)
+
+var serverStartTime = time.Now()
+var statNumConnections atomic.Int64
+var statRejectedConn atomic.Int64
+var statNumCommands atomic.Int64
+var statExpiredKeys atomic.Int64
+var statExpiredTimeCapReached atomic.Int64
+
+var infoSections = []struct {
+	name  string
+	lines func() []string
+}{
+	{"server", infoServer},
+	{"clients", infoClients},
+	{"stats", infoStats},
+	{"keyspace", infoKeyspace},
+}
+
+func infoServer() []string {
+	conf := currentConfig()
+	uptime := int(time.Since(serverStartTime) / time.Second)
+	return []string{
+		"redis_version:" + serverVersion,
+		"redis_mode:standalone",
+		"os:" + runtime.GOOS,
+		"arch_bits:" + strconv.Itoa(strconv.IntSize),
+		"go_version:" + runtime.Version(),
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"tcp_port:" + strconv.Itoa(conf.port),
+		"uptime_in_seconds:" + strconv.Itoa(uptime),
+		"uptime_in_days:" + strconv.Itoa(uptime/86400),
+		"config_file:" + configFile,
+	}
+}
+
+func infoClients() []string {
+	clientsLock.Lock()
+	connected := len(clients)
+	clientsLock.Unlock()
+	return []string{
+		"connected_clients:" + strconv.Itoa(connected),
+		"maxclients:" + strconv.Itoa(currentConfig().maxClients),
+		"blocked_clients:" + strconv.FormatInt(blockedClients.Load(), 10),
+	}
+}
+
+func infoStats() []string {
+	return []string{
+		"total_connections_received:" + strconv.FormatInt(statNumConnections.Load(), 10),
+		"total_commands_processed:" + strconv.FormatInt(statNumCommands.Load(), 10),
+		"rejected_connections:" + strconv.FormatInt(statRejectedConn.Load(), 10),
+		"expired_keys:" + strconv.FormatInt(statExpiredKeys.Load(), 10),
+		"expired_time_cap_reached_count:" + strconv.FormatInt(statExpiredTimeCapReached.Load(), 10),
+	}
+}
+
+func infoKeyspace() []string {
+	var lines []string
+	for _, db := range dbs {
+		keys, expires := db.size()
+		if keys == 0 {
+			continue
+		}
+		lines = append(lines, "db"+strconv.Itoa(db.id)+":keys="+strconv.Itoa(keys)+
+			",expires="+strconv.Itoa(expires)+",avg_ttl="+strconv.FormatInt(db.avgTTL.Load(), 10))
+	}
+	return lines
+}
+
+func doInfo(_ *client, opt ...string) *cmdResult {
+	wanted := make(map[string]bool)
+	all := len(opt) == 0
+	for _, section := range opt {
+		section = strings.ToLower(section)
+		if section == "all" || section == "everything" || section == "default" {
+			all = true
+		}
+		wanted[section] = true
+	}
+	var buf strings.Builder
+	for _, section := range infoSections {
+		if all == false && wanted[section.name] == false {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, line := range section.lines() {
+			buf.WriteString(line)
+			buf.WriteString("\r\n")
+		}
+	}
+	return commandResVerbatim(buf.String())
+}
+
+func parseFlushOption(opt ...string) *cmdResult {
+	if len(opt) > 1 || (len(opt) == 1 && strings.ToLower(opt[0]) != "async" && strings.ToLower(opt[0]) != "sync") {
+		return commandResErrSyntax()
+	}
+	return nil
+}
+
+func doFlushAll(_ *client, opt ...string) *cmdResult {
+	if res := parseFlushOption(opt...); res != nil {
+		return res
+	}
+	flushAll()
 	return commandResOk()
 }
 
-func doFlushDb(_ ...string) *cmdResult {
+func doFlushDb(c *client, opt ...string) *cmdResult {
+	if res := parseFlushOption(opt...); res != nil {
+		return res
+	}
+	c.db.flushDb()
 	return commandResOk()
 }
@@ -11,8 +11,8 @@ func createSetsNode(key string) *dataNode {
 	return node
 }
 
-func baseSetsGet(key string) (setsNodeData, *cmdResult) {
-	data, ex := getFromDb(key)
+func baseSetsGet(db *redisDb, key string) (setsNodeData, *cmdResult) {
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeSet {
 			return nil, commandResErrType()
@@ -26,9 +26,9 @@ func baseSetsGet(key string) (setsNodeData, *cmdResult) {
 	}
 }
 
-func baseSetsAdd(key string, value string) *cmdResult {
+func baseSetsAdd(db *redisDb, key string, value string) *cmdResult {
 	var sets setsNodeData
-	data, ex := getFromDb(key)
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeSet {
 			return commandResErrType()
@@ -46,17 +46,17 @@ func baseSetsAdd(key string, value string) *cmdResult {
 	}
 	sets[value] = value
 	data.dataPointer = interface{}(sets)
-	setToDb(key, data)
+	db.setToDb(key, data)
 	return commandResInt(1)
 }
 
-func baseSDiff(keys ...string) (setsNodeData, *cmdResult) {
-	res, cmd := baseSUnion(keys[1:]...)
+func baseSDiff(db *redisDb, keys ...string) (setsNodeData, *cmdResult) {
+	res, cmd := baseSUnion(db, keys[1:]...)
 	if res == nil {
 		return nil, cmd
 	}
 	var set0 setsNodeData
-	set0, cmd = baseSetsGet(keys[0])
+	set0, cmd = baseSetsGet(db, keys[0])
 	if set0 == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return nil, cmd
@@ -73,10 +73,10 @@ func baseSDiff(keys ...string) (setsNodeData, *cmdResult) {
 	return diffRes, nil
 }
 
-func baseSInter(keys ...string) (setsNodeData, *cmdResult) {
+func baseSInter(db *redisDb, keys ...string) (setsNodeData, *cmdResult) {
 	countList := make(map[string]int)
 	for _, key := range keys {
-		node, cmd := baseSetsGet(key)
+		node, cmd := baseSetsGet(db, key)
 		if node == nil {
 			if cmd != nil && cmd.resType == resTypeFail {
 				return nil, cmd
@@ -99,10 +99,10 @@ func baseSInter(keys ...string) (setsNodeData, *cmdResult) {
 	}
 	return res, nil
 }
-func baseSUnion(keys ...string) (setsNodeData, *cmdResult) {
+func baseSUnion(db *redisDb, keys ...string) (setsNodeData, *cmdResult) {
 	res := make(setsNodeData)
 	for _, key := range keys {
-		node, cmd := baseSetsGet(key)
+		node, cmd := baseSetsGet(db, key)
 		if node == nil {
 			if cmd != nil && cmd.resType == resTypeFail {
 				return nil, cmd
@@ -116,11 +116,27 @@ func baseSUnion(keys ...string) (setsNodeData, *cmdResult) {
 	return res, nil
 }
 
-func doSAdd(opt ...string) *cmdResult {
+// baseSetsStore replaces key with the result of a *STORE command, an empty
+// result only deletes it.
+func baseSetsStore(db *redisDb, key, event string, node setsNodeData) *cmdResult {
+	_, ex := db.rmFromDb(key)
+	for member := range node {
+		baseSetsAdd(db, key, member)
+	}
+	if len(node) > 0 {
+		db.notifyKeyspaceEvent(notifySet, event, key)
+	} else if ex {
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+	return commandResInt(len(node))
+}
+
+func doSAdd(c *client, opt ...string) *cmdResult {
+	db := c.db
 	var count = 0
 	key := opt[0]
 	for _, value := range opt[1:] {
-		cmd := baseSetsAdd(key, value)
+		cmd := baseSetsAdd(db, key, value)
 		if cmd.resType != resTypeInt {
 			return cmd
 		}
@@ -128,12 +144,16 @@ func doSAdd(opt ...string) *cmdResult {
 			count++
 		}
 	}
+	if count > 0 {
+		db.notifyKeyspaceEvent(notifySet, "sadd", key)
+	}
 	return commandResInt(count)
 }
 
-func doSCard(opt ...string) *cmdResult {
+func doSCard(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -143,8 +163,9 @@ func doSCard(opt ...string) *cmdResult {
 	return commandResInt(len(node))
 }
 
-func doSDiff(opt ...string) *cmdResult {
-	res, cmd := baseSDiff(opt...)
+func doSDiff(c *client, opt ...string) *cmdResult {
+	db := c.db
+	res, cmd := baseSDiff(db, opt...)
 	if res == nil {
 		return cmd
 	}
@@ -154,30 +175,28 @@ func doSDiff(opt ...string) *cmdResult {
 		resList[i] = commandResString(member)
 		i++
 	}
-	return commandResArray(resList)
+	return commandResSet(resList)
 }
 
-func doSDiffStore(opt ...string) *cmdResult {
+func doSDiffStore(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
 	}
-	node, cmd = baseSDiff(opt[1:]...)
+	node, cmd = baseSDiff(db, opt[1:]...)
 	if node == nil {
 		return cmd
 	}
-	rmFromDb(key)
-	for member := range node {
-		baseSetsAdd(key, member)
-	}
-	return commandResInt(len(node))
+	return baseSetsStore(db, key, "sdiffstore", node)
 }
 
-func doSInter(opt ...string) *cmdResult {
-	res, cmd := baseSInter(opt...)
+func doSInter(c *client, opt ...string) *cmdResult {
+	db := c.db
+	res, cmd := baseSInter(db, opt...)
 	if res == nil {
 		return cmd
 	}
@@ -187,32 +206,30 @@ func doSInter(opt ...string) *cmdResult {
 		resList[i] = commandResString(member)
 		i++
 	}
-	return commandResArray(resList)
+	return commandResSet(resList)
 }
 
-func doSInterStore(opt ...string) *cmdResult {
+func doSInterStore(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
 	}
-	node, cmd = baseSInter(opt[1:]...)
+	node, cmd = baseSInter(db, opt[1:]...)
 	if node == nil {
 		return cmd
 	}
-	rmFromDb(key)
-	for member := range node {
-		baseSetsAdd(key, member)
-	}
-	return commandResInt(len(node))
+	return baseSetsStore(db, key, "sinterstore", node)
 }
 
-func doSIsMember(opt ...string) *cmdResult {
+func doSIsMember(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	member := opt[1]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -225,14 +242,15 @@ func doSIsMember(opt ...string) *cmdResult {
 	return commandResInt(0)
 }
 
-func doSMembers(opt ...string) *cmdResult {
+func doSMembers(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
-		return commandResEmptyArray()
+		return commandResSet(nil)
 	}
 	resList := make([]*cmdResult, len(node))
 	i := 0
@@ -240,21 +258,22 @@ func doSMembers(opt ...string) *cmdResult {
 		resList[i] = commandResString(member)
 		i++
 	}
-	return commandResArray(resList)
+	return commandResSet(resList)
 }
 
-func doSMove(opt ...string) *cmdResult {
+func doSMove(c *client, opt ...string) *cmdResult {
+	db := c.db
 	sk := opt[0]
 	dk := opt[1]
 	member := opt[2]
-	nodeS, cmd := baseSetsGet(sk)
+	nodeS, cmd := baseSetsGet(db, sk)
 	if nodeS == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
 		return commandResInt(0)
 	}
-	nodeD, cmd := baseSetsGet(dk)
+	nodeD, cmd := baseSetsGet(db, dk)
 	if nodeD == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -264,8 +283,12 @@ func doSMove(opt ...string) *cmdResult {
 		return commandResInt(0)
 	}
 	delete(nodeS, member)
-	baseSetsAdd(dk, member)
-	rmIfEmpty(sk)
+	db.signalModifiedKey(sk)
+	db.notifyKeyspaceEvent(notifySet, "srem", sk)
+	if res := baseSetsAdd(db, dk, member); res.resInt == 1 {
+		db.notifyKeyspaceEvent(notifySet, "sadd", dk)
+	}
+	db.rmIfEmpty(sk)
 	return commandResInt(1)
 }
 
@@ -273,9 +296,10 @@ func doSMove(opt ...string) *cmdResult {
 
 //func doSRandMember(opt ...string) *cmdResult {}
 
-func doSRem(opt ...string) *cmdResult {
+func doSRem(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
@@ -289,12 +313,17 @@ func doSRem(opt ...string) *cmdResult {
 			count++
 		}
 	}
-	rmIfEmpty(key)
+	if count > 0 {
+		db.signalModifiedKey(key)
+		db.notifyKeyspaceEvent(notifySet, "srem", key)
+	}
+	db.rmIfEmpty(key)
 	return commandResInt(count)
 }
 
-func doSUnion(opt ...string) *cmdResult {
-	res, cmd := baseSUnion(opt...)
+func doSUnion(c *client, opt ...string) *cmdResult {
+	db := c.db
+	res, cmd := baseSUnion(db, opt...)
 	if res == nil {
 		return cmd
 	}
@@ -304,24 +333,21 @@ func doSUnion(opt ...string) *cmdResult {
 		resList[i] = commandResString(member)
 		i++
 	}
-	return commandResArray(resList)
+	return commandResSet(resList)
 }
 
-func doSUnionStore(opt ...string) *cmdResult {
+func doSUnionStore(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	node, cmd := baseSetsGet(key)
+	node, cmd := baseSetsGet(db, key)
 	if node == nil {
 		if cmd != nil && cmd.resType == resTypeFail {
 			return cmd
 		}
 	}
-	node, cmd = baseSUnion(opt[1:]...)
+	node, cmd = baseSUnion(db, opt[1:]...)
 	if node == nil {
 		return cmd
 	}
-	rmFromDb(key)
-	for member := range node {
-		baseSetsAdd(key, member)
-	}
-	return commandResInt(len(node))
+	return baseSetsStore(db, key, "sunionstore", node)
 }
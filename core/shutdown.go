@@ -0,0 +1,86 @@
+package core
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	shutdownSave   = 1
+	shutdownNoSave = 2
+	shutdownNow    = 4
+	shutdownForce  = 8
+)
+
+var shutdownCh = make(chan int, 1)
+var shuttingDown atomic.Bool
+
+// shutdownNoWait drops the output clients have not read yet instead of
+// giving them time to drain it, for SHUTDOWN NOW.
+var shutdownNoWait atomic.Bool
+
+func ShutdownRequested() <-chan int {
+	return shutdownCh
+}
+
+func PrepareForShutdown(force bool) error {
+	flags := 0
+	if force {
+		flags = shutdownForce
+	}
+	keyspaceLock.Lock()
+	defer keyspaceLock.Unlock()
+	return prepareForShutdown(flags)
+}
+
+func prepareForShutdown(flags int) error {
+	save := currentConfig().save != ""
+	if flags&shutdownSave != 0 {
+		save = true
+	}
+	if flags&shutdownNoSave != 0 {
+		save = false
+	}
+	shutdownNoWait.Store(flags&shutdownNow != 0)
+	if save {
+		serverLog(logNotice, nil, "Saving the final snapshot before exiting.")
+		if err := saveDb(); err != nil {
+			serverLog(logWarning, nil, "Error trying to save the DB: "+err.Error())
+			if flags&shutdownForce != 0 {
+				shuttingDown.Store(true)
+			}
+			return err
+		}
+	}
+	shuttingDown.Store(true)
+	return nil
+}
+
+func doShutdown(_ *client, opt ...string) *cmdResult {
+	flags := 0
+	for _, option := range opt {
+		switch strings.ToLower(option) {
+		case "save":
+			flags |= shutdownSave
+		case "nosave":
+			flags |= shutdownNoSave
+		case "now":
+			flags |= shutdownNow
+		case "force":
+			flags |= shutdownForce
+		default:
+			return commandResErrSyntax()
+		}
+	}
+	if flags&shutdownSave != 0 && flags&shutdownNoSave != 0 {
+		return commandResErrSyntax()
+	}
+	if err := prepareForShutdown(flags); err != nil && shuttingDown.Load() == false {
+		return commandResErr("ERR Errors trying to SHUTDOWN. Check logs.")
+	}
+	select {
+	case shutdownCh <- 0:
+	default:
+	}
+	return nil
+}
@@ -25,8 +25,8 @@ func getSSetNodeFromElement(e *list.Element) *sortedSetNode {
 	return nil
 }
 
-func baseSSetListGet(key string) (*list.List, *cmdResult) {
-	data, ex := getFromDb(key)
+func baseSSetListGet(db *redisDb, key string) (*list.List, *cmdResult) {
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeSortedSet {
 			return nil, commandResErrType()
@@ -40,89 +40,89 @@ func baseSSetListGet(key string) (*list.List, *cmdResult) {
 	}
 }
 
-func baseSSetListSet(key string) *list.List {
+func baseSSetListSet(db *redisDb, key string) *list.List {
 	l := list.New()
 	node := createListNode(key, l)
-	setToDb(key, node)
+	db.setToDb(key, node)
 	return l
 }
 
-func doZAdd(_ ...string) *cmdResult {
+func doZAdd(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZCard(_ ...string) *cmdResult {
+func doZCard(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZCount(_ ...string) *cmdResult {
+func doZCount(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZIncrBy(_ ...string) *cmdResult {
+func doZIncrBy(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZInterStore(_ ...string) *cmdResult {
+func doZInterStore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZLexCount(_ ...string) *cmdResult {
+func doZLexCount(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRange(_ ...string) *cmdResult {
+func doZRange(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRangeByLex(_ ...string) *cmdResult {
+func doZRangeByLex(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRevRangeByLex(_ ...string) *cmdResult {
+func doZRevRangeByLex(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRangeByScore(_ ...string) *cmdResult {
+func doZRangeByScore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRank(_ ...string) *cmdResult {
+func doZRank(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRem(_ ...string) *cmdResult {
+func doZRem(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRemRrangeByLex(_ ...string) *cmdResult {
+func doZRemRrangeByLex(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRemRangeByRank(_ ...string) *cmdResult {
+func doZRemRangeByRank(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRemRangeByScore(_ ...string) *cmdResult {
+func doZRemRangeByScore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRevRange(_ ...string) *cmdResult {
+func doZRevRange(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRevRangeByScore(_ ...string) *cmdResult {
+func doZRevRangeByScore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZRevRank(_ ...string) *cmdResult {
+func doZRevRank(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZScore(_ ...string) *cmdResult {
+func doZScore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
 
-func doZUnionStore(_ ...string) *cmdResult {
+func doZUnionStore(_ *client, _ ...string) *cmdResult {
 	return commandResString("todo")
 }
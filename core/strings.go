@@ -14,8 +14,8 @@ func createStringNode(key, str string, ttlOfMs int) *dataNode {
 	return node
 }
 
-func baseGet(key string) *cmdResult {
-	data, ex := getFromDb(key)
+func baseGet(db *redisDb, key string) *cmdResult {
+	data, ex := db.getFromDb(key)
 	if ex {
 		if data.dataType != dataNodeTypeString {
 			return commandResErrType()
@@ -30,11 +30,11 @@ func baseGet(key string) *cmdResult {
 	}
 }
 
-func baseSet(key, value string, ttlSetFlag bool, ttlMs int, nxFlag bool, xxFlag bool) *cmdResult {
+func baseSet(db *redisDb, key, value string, ttlSetFlag bool, ttlMs int, nxFlag bool, xxFlag bool) *cmdResult {
 	if ttlMs <= 0 && ttlSetFlag {
 		return commandResErr("ERR invalid expire time")
 	}
-	data, ex := getFromDb(key)
+	data, ex := db.getFromDb(key)
 	if ex {
 		if nxFlag {
 			return commandResNil()
@@ -53,23 +53,34 @@ func baseSet(key, value string, ttlSetFlag bool, ttlMs int, nxFlag bool, xxFlag
 		data = createStringNode(key, value, ttlMs)
 	}
 	data.dataType = dataNodeTypeString
-	setToDb(key, data)
+	db.setToDb(key, data)
 	return commandResOk()
 }
 
-func baseMSet(nxFlag bool, opt ...string) *cmdResult {
+func baseSetEx(db *redisDb, key, value string, ttlMs int) *cmdResult {
+	res := baseSet(db, key, value, true, ttlMs, false, false)
+	if res.resType == resTypeMsg {
+		db.notifyKeyspaceEvent(notifyString, "set", key)
+		db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+	}
+	return res
+}
+
+func baseMSet(db *redisDb, nxFlag bool, opt ...string) *cmdResult {
 	if len(opt)%2 == 1 {
 		return commandResErr("ERR wrong number of arguments for MSET")
 	}
 	if nxFlag {
 		for i := 0; i < len(opt); i += 2 {
-			if _, ex := getFromDb(opt[i]); ex {
+			if _, ex := db.getFromDb(opt[i]); ex {
 				return commandResInt(0)
 			}
 		}
 	}
 	for i := 0; i < len(opt); i += 2 {
-		baseSet(opt[i], opt[i+1], false, 0, false, false)
+		baseSet(db, opt[i], opt[i+1], false, 0, false, false)
+		persistKey(db, opt[i])
+		db.notifyKeyspaceEvent(notifyString, "set", opt[i])
 	}
 	if nxFlag {
 		return commandResInt(1)
@@ -78,12 +89,12 @@ func baseMSet(nxFlag bool, opt ...string) *cmdResult {
 	}
 }
 
-func baseIncr(key, value string) *cmdResult {
+func baseIncr(db *redisDb, key, value string) *cmdResult {
 	delta, err := strconv.Atoi(value)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeFail {
 		return cmd
 	}
@@ -98,16 +109,17 @@ func baseIncr(key, value string) *cmdResult {
 		}
 	}
 	valueInt = valueInt + delta
-	baseSet(key, strconv.Itoa(valueInt), false, 0, false, false)
+	baseSet(db, key, strconv.Itoa(valueInt), false, 0, false, false)
+	db.notifyKeyspaceEvent(notifyString, "incrby", key)
 	return commandResInt(valueInt)
 }
 
-func baseDecr(key, value string) *cmdResult {
+func baseDecr(db *redisDb, key, value string) *cmdResult {
 	delta, err := strconv.Atoi(value)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeFail {
 		return cmd
 	}
@@ -122,14 +134,16 @@ func baseDecr(key, value string) *cmdResult {
 		}
 	}
 	valueInt = valueInt - delta
-	baseSet(key, strconv.Itoa(valueInt), false, 0, false, false)
+	baseSet(db, key, strconv.Itoa(valueInt), false, 0, false, false)
+	db.notifyKeyspaceEvent(notifyString, "decrby", key)
 	return commandResInt(valueInt)
 }
 
-func doAppend(opt ...string) *cmdResult {
+func doAppend(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	value := opt[1]
-	data, ex := getFromDb(key)
+	data, ex := db.getFromDb(key)
 	var str string
 	if ex {
 		if data.dataType != dataNodeTypeString {
@@ -144,16 +158,18 @@ func doAppend(opt ...string) *cmdResult {
 		str = ""
 	}
 	str = str + value
-	cmd := baseSet(key, str, false, 0, false, false)
+	cmd := baseSet(db, key, str, false, 0, false, false)
 	if cmd.resType != resTypeMsg {
 		return cmd
 	}
+	db.notifyKeyspaceEvent(notifyString, "append", key)
 	return commandResInt(len(str))
 }
 
-func doBitCount(opt ...string) *cmdResult {
+func doBitCount(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	var str string
 	if cmd.resType == resTypeString {
 		str = cmd.resMsg
@@ -211,7 +227,8 @@ func doBitCount(opt ...string) *cmdResult {
 	return commandResInt(count)
 }
 
-func doBitOp(opt ...string) *cmdResult {
+func doBitOp(c *client, opt ...string) *cmdResult {
+	db := c.db
 	opStr := strings.ToLower(opt[0])
 	if opStr != "and" && opStr != "or" && opStr != "xor" && opStr != "not" {
 		return commandResErrSyntax()
@@ -224,7 +241,7 @@ func doBitOp(opt ...string) *cmdResult {
 	maxLenPos := 0
 	valuesList := make([]string, len(opt)-2)
 	for i, key := range opt[2:] {
-		cmd := baseGet(key)
+		cmd := baseGet(db, key)
 		if cmd.resType == resTypeFail {
 			return cmd
 		}
@@ -240,7 +257,8 @@ func doBitOp(opt ...string) *cmdResult {
 			b := valuesList[0][i]
 			res[i] = 0xff ^ b
 		}
-		baseSet(setKey, string(res), false, 0, false, false)
+		baseSet(db, setKey, string(res), false, 0, false, false)
+		db.notifyKeyspaceEvent(notifyString, "set", setKey)
 		return commandResInt(len(res))
 	}
 	res := []byte(valuesList[maxLenPos])
@@ -260,18 +278,20 @@ func doBitOp(opt ...string) *cmdResult {
 			}
 		}
 	}
-	baseSet(setKey, string(res), false, 0, false, false)
+	baseSet(db, setKey, string(res), false, 0, false, false)
+	db.notifyKeyspaceEvent(notifyString, "set", setKey)
 	return commandResInt(len(res))
 }
 
-func doBitPos(opt ...string) *cmdResult {
+func doBitPos(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	bitStr := opt[1]
 	bit, err := strconv.Atoi(bitStr)
 	if err != nil || (bit != 0 && bit != 1) {
 		return commandResErrParseInt("bit")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	var str string
 	if cmd.resType == resTypeString {
 		str = cmd.resMsg
@@ -348,27 +368,31 @@ func doBitPos(opt ...string) *cmdResult {
 	return commandResInt(findPos)
 }
 
-func doDecr(opt ...string) *cmdResult {
-	return baseDecr(opt[0], "1")
+func doDecr(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseDecr(db, opt[0], "1")
 }
 
-func doDecrBy(opt ...string) *cmdResult {
-	return baseDecr(opt[0], opt[1])
+func doDecrBy(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseDecr(db, opt[0], opt[1])
 }
 
-func doGet(opt ...string) *cmdResult {
+func doGet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	return baseGet(key)
+	return baseGet(db, key)
 }
 
-func doGetBit(opt ...string) *cmdResult {
+func doGetBit(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	offsetStr := opt[1]
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil || offset < 0 {
 		return commandResErrParseInt("bit offset")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	var str string
 	if cmd.resType == resTypeString {
 		str = cmd.resMsg
@@ -391,7 +415,8 @@ func doGetBit(opt ...string) *cmdResult {
 	return commandResInt(res)
 }
 
-func doGetRange(opt ...string) *cmdResult {
+func doGetRange(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	startStr := opt[1]
 	endStr := opt[2]
@@ -405,7 +430,7 @@ func doGetRange(opt ...string) *cmdResult {
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeFail {
 		return cmd
 	}
@@ -429,33 +454,39 @@ func doGetRange(opt ...string) *cmdResult {
 	return commandResString(cmd.resMsg[start:end])
 }
 
-func doGetSet(opt ...string) *cmdResult {
+func doGetSet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	value := opt[1]
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeFail {
 		return cmd
 	}
-	baseSet(key, value, false, 0, false, false)
+	baseSet(db, key, value, false, 0, false, false)
+	persistKey(db, key)
+	db.notifyKeyspaceEvent(notifyString, "set", key)
 	return cmd
 }
 
-func doIncr(opt ...string) *cmdResult {
-	return baseIncr(opt[0], "1")
+func doIncr(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseIncr(db, opt[0], "1")
 }
 
-func doIncrBy(opt ...string) *cmdResult {
-	return baseIncr(opt[0], opt[1])
+func doIncrBy(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseIncr(db, opt[0], opt[1])
 }
 
-func doIncrByFloat(opt ...string) *cmdResult {
+func doIncrByFloat(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	valueString := opt[1]
 	value, err := strconv.ParseFloat(valueString, 64)
 	if err != nil {
 		return commandResErr("ERR value is not a valid float")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeFail {
 		return cmd
 	}
@@ -470,14 +501,16 @@ func doIncrByFloat(opt ...string) *cmdResult {
 		}
 	}
 	valueFloat = valueFloat + value
-	baseSet(key, strconv.FormatFloat(valueFloat, 'f', -1, 64), false, 0, false, false)
-	return baseGet(key)
+	baseSet(db, key, strconv.FormatFloat(valueFloat, 'f', -1, 64), false, 0, false, false)
+	db.notifyKeyspaceEvent(notifyString, "incrbyfloat", key)
+	return commandResDouble(valueFloat)
 }
 
-func doMGet(opt ...string) *cmdResult {
+func doMGet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	resList := make([]*cmdResult, len(opt))
 	for i, key := range opt {
-		data, ex := getFromDb(key)
+		data, ex := db.getFromDb(key)
 		if ex {
 			if data.dataType != dataNodeTypeString {
 				resList[i] = commandResErrType()
@@ -494,35 +527,45 @@ func doMGet(opt ...string) *cmdResult {
 	return commandResArray(resList)
 }
 
-func doMSet(opt ...string) *cmdResult {
-	return baseMSet(false, opt...)
+func doMSet(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseMSet(db, false, opt...)
 }
 
-func doMSetNx(opt ...string) *cmdResult {
-	return baseMSet(true, opt...)
+func doMSetNx(c *client, opt ...string) *cmdResult {
+	db := c.db
+	return baseMSet(db, true, opt...)
 }
 
-func doPSetEx(opt ...string) *cmdResult {
+func doPSetEx(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	value := opt[1]
-	ttlStr := opt[2]
+	ttlStr := opt[1]
+	value := opt[2]
 	ttl, err := strconv.Atoi(ttlStr)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	return baseSet(key, value, true, ttl, false, false)
+	return baseSetEx(db, key, value, ttl)
 }
 
-func doSet(opt ...string) *cmdResult {
+func doSet(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	value := opt[1]
 	nxFlag := false
 	xxFlag := false
 	ttlSetFlag := false
+	keepTTL := false
 	ttlMs := 0
 	for i := 2; i < len(opt); i++ {
 		option := strings.ToLower(opt[i])
 		switch option {
+		case "keepttl":
+			if ttlSetFlag {
+				return commandResErrSyntax()
+			}
+			keepTTL = true
 		case "nx":
 			if nxFlag || xxFlag {
 				return commandResErrSyntax()
@@ -534,7 +577,7 @@ func doSet(opt ...string) *cmdResult {
 			}
 			xxFlag = true
 		case "ex":
-			if ttlSetFlag {
+			if ttlSetFlag || keepTTL || i+1 >= len(opt) {
 				return commandResErrSyntax()
 			}
 			ttlSetFlag = true
@@ -546,7 +589,7 @@ func doSet(opt ...string) *cmdResult {
 			}
 			ttlMs = ttlMs * 1000
 		case "px":
-			if ttlSetFlag {
+			if ttlSetFlag || keepTTL || i+1 >= len(opt) {
 				return commandResErrSyntax()
 			}
 			ttlSetFlag = true
@@ -560,22 +603,34 @@ func doSet(opt ...string) *cmdResult {
 			return commandResErrSyntax()
 		}
 	}
-	return baseSet(key, value, ttlSetFlag, ttlMs, nxFlag, xxFlag)
+	res := baseSet(db, key, value, ttlSetFlag, ttlMs, nxFlag, xxFlag)
+	if res.resType != resTypeMsg {
+		return res
+	}
+	if ttlSetFlag == false && keepTTL == false {
+		persistKey(db, key)
+	}
+	db.notifyKeyspaceEvent(notifyString, "set", key)
+	if ttlSetFlag {
+		db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+	}
+	return res
 }
 
-func doSetBit(opt ...string) *cmdResult {
+func doSetBit(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	posStr := opt[1]
 	bitStr := opt[2]
 	pos, err := strconv.Atoi(posStr)
-	if err != nil || pos < 0 {
+	if err != nil || pos < 0 || int64(pos/8) >= currentConfig().protoMaxBulkLen {
 		return commandResErrParseInt("bit offset")
 	}
 	bit, err := strconv.Atoi(bitStr)
 	if err != nil || (bit != 0 && bit != 1) {
 		return commandResErrParseInt("bit")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	var str string
 	if cmd.resType == resTypeString {
 		str = cmd.resMsg
@@ -606,26 +661,30 @@ func doSetBit(opt ...string) *cmdResult {
 	} else {
 		cap[testPos] = cap[testPos] | testByte
 	}
-	baseSet(key, string(cap), false, 0, false, false)
+	baseSet(db, key, string(cap), false, 0, false, false)
+	db.notifyKeyspaceEvent(notifyString, "setbit", key)
 	return commandResInt(res)
 }
 
-func doSetEx(opt ...string) *cmdResult {
+func doSetEx(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	value := opt[1]
-	ttlStr := opt[2]
+	ttlStr := opt[1]
+	value := opt[2]
 	ttl, err := strconv.Atoi(ttlStr)
 	if err != nil {
 		return commandResErrParseInt("value")
 	}
-	return baseSet(key, value, true, ttl*1000, false, false)
+	return baseSetEx(db, key, value, ttl*1000)
 }
 
-func doSetNx(opt ...string) *cmdResult {
+func doSetNx(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	value := opt[1]
-	cmd := baseSet(key, value, false, 0, true, false)
+	cmd := baseSet(db, key, value, false, 0, true, false)
 	if cmd.resType == resTypeMsg {
+		db.notifyKeyspaceEvent(notifyString, "set", key)
 		return commandResInt(1)
 	} else if cmd.resType == resTypeNil {
 		return commandResInt(0)
@@ -633,7 +692,8 @@ func doSetNx(opt ...string) *cmdResult {
 	return cmd
 }
 
-func doSetRange(opt ...string) *cmdResult {
+func doSetRange(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
 	posStr := opt[1]
 	value := opt[2]
@@ -641,21 +701,19 @@ func doSetRange(opt ...string) *cmdResult {
 	if err != nil || pos < 0 {
 		return commandResErrParseInt("offset")
 	}
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	var str string
-	var ex bool
 	if cmd.resType == resTypeString {
 		str = cmd.resMsg
-		ex = true
-	} else if cmd.resType == resTypeNil {
-		str = ""
-		ex = false
-	} else {
+	} else if cmd.resType != resTypeNil {
 		return cmd
 	}
 	addLen := len(value)
-	if addLen == 0 && ex == false {
-		return commandResInt(0)
+	if addLen == 0 {
+		return commandResInt(len(str))
+	}
+	if int64(pos) > currentConfig().protoMaxBulkLen-int64(addLen) {
+		return commandResErr("ERR string exceeds maximum allowed size")
 	}
 	oldLen := len(str)
 	capLen := addLen + pos
@@ -669,13 +727,17 @@ func doSetRange(opt ...string) *cmdResult {
 	for i := 0; i < addLen; i++ {
 		cap[i+pos] = value[i]
 	}
-	baseSet(key, string(cap), false, 0, false, false)
+	baseSet(db, key, string(cap), false, 0, false, false)
+	if addLen > 0 {
+		db.notifyKeyspaceEvent(notifyString, "setrange", key)
+	}
 	return commandResInt(len(string(cap)))
 }
 
-func doStrlen(opt ...string) *cmdResult {
+func doStrlen(c *client, opt ...string) *cmdResult {
+	db := c.db
 	key := opt[0]
-	cmd := baseGet(key)
+	cmd := baseGet(db, key)
 	if cmd.resType == resTypeString {
 		return commandResInt(len(cmd.resMsg))
 	} else if cmd.resType == resTypeNil {
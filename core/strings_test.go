@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestSetRangeOffsetOutOfRange(t *testing.T) {
+	session := newTestSession(t)
+	for _, offset := range []string{"9223372036854775807", "536870912"} {
+		reply := session.Do("SETRANGE", "s", offset, "x")
+		if reply.Err() == nil || reply.Err().Error() != "ERR string exceeds maximum allowed size" {
+			t.Fatalf("SETRANGE offset %s: %+v", offset, reply)
+		}
+	}
+	if n, _ := mustDo(t, session, "SETRANGE", "s", "2", "ab").Integer(); n != 4 {
+		t.Fatalf("SETRANGE: %d", n)
+	}
+	if n, _ := mustDo(t, session, "SETRANGE", "s", "100", "").Integer(); n != 4 {
+		t.Fatalf("SETRANGE with an empty value: %d", n)
+	}
+}
+
+func TestSetBitOffsetOutOfRange(t *testing.T) {
+	session := newTestSession(t)
+	for _, offset := range []string{"4611686018427387904", "4294967296"} {
+		reply := session.Do("SETBIT", "s", offset, "1")
+		if reply.Err() == nil || reply.Err().Error() != "ERR bit offset is not an integer or out of range" {
+			t.Fatalf("SETBIT offset %s: %+v", offset, reply)
+		}
+	}
+	mustDo(t, session, "SETBIT", "s", "15", "1")
+	if n, _ := mustDo(t, session, "STRLEN", "s").Integer(); n != 2 {
+		t.Fatalf("STRLEN: %d", n)
+	}
+}
+
+func TestMSetClearsTTL(t *testing.T) {
+	session := newTestSession(t)
+	mustDo(t, session, "SET", "a", "1", "EX", "100")
+	mustDo(t, session, "MSET", "a", "2", "b", "2")
+	if ttl, _ := mustDo(t, session, "TTL", "a").Integer(); ttl != -1 {
+		t.Fatalf("TTL after MSET: %d", ttl)
+	}
+}
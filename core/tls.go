@@ -0,0 +1,128 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type tlsContext struct {
+	cert        tls.Certificate
+	caPool      *x509.CertPool
+	authClients string
+}
+
+var tlsCurrent *tlsContext
+var tlsLock sync.RWMutex
+
+func init() {
+	for _, name := range []string{"tls-cert-file", "tls-key-file", "tls-ca-cert-file", "tls-auth-clients"} {
+		configApplyHooks[name] = applyTLSConfig
+	}
+}
+
+func newTLSContext(conf *config) (*tlsContext, error) {
+	if conf.tlsCertFile == "" || conf.tlsKeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(conf.tlsCertFile, conf.tlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ctx := new(tlsContext)
+	ctx.cert = cert
+	ctx.authClients = conf.tlsAuthClients
+	if conf.tlsCaCertFile != "" {
+		pem, err := os.ReadFile(conf.tlsCaCertFile)
+		if err != nil {
+			return nil, err
+		}
+		ctx.caPool = x509.NewCertPool()
+		if ctx.caPool.AppendCertsFromPEM(pem) == false {
+			return nil, errors.New("no certificates found in " + conf.tlsCaCertFile)
+		}
+	} else if conf.tlsAuthClients != "no" {
+		return nil, errors.New("tls-ca-cert-file is required to authenticate clients")
+	}
+	return ctx, nil
+}
+
+func applyTLSConfig(conf *config) error {
+	if conf.tlsPort == 0 {
+		return nil
+	}
+	ctx, err := newTLSContext(conf)
+	if err != nil {
+		return err
+	}
+	tlsLock.Lock()
+	tlsCurrent = ctx
+	tlsLock.Unlock()
+	return nil
+}
+
+func LoadTLS() error {
+	conf := currentConfig()
+	return applyTLSConfig(&conf)
+}
+
+func TLSListenAddrs() []string {
+	conf := currentConfig()
+	if conf.tlsPort == 0 {
+		return nil
+	}
+	addrs := make([]string, len(conf.bind))
+	for i, host := range conf.bind {
+		addrs[i] = net.JoinHostPort(host, strconv.Itoa(conf.tlsPort))
+	}
+	return addrs
+}
+
+func TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			tlsLock.RLock()
+			ctx := tlsCurrent
+			tlsLock.RUnlock()
+			if ctx == nil {
+				return nil, errors.New("TLS is not configured")
+			}
+			conf := &tls.Config{
+				Certificates: []tls.Certificate{ctx.cert},
+				ClientCAs:    ctx.caPool,
+				MinVersion:   tls.VersionTLS12,
+			}
+			switch ctx.authClients {
+			case "yes":
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			case "optional":
+				conf.ClientAuth = tls.VerifyClientCertIfGiven
+			default:
+				conf.ClientAuth = tls.NoClientCert
+			}
+			return conf, nil
+		},
+	}
+}
+
+func (this *client) tlsHandshake() error {
+	tlsConn, ok := this.conn.(*tls.Conn)
+	if ok == false {
+		return nil
+	}
+	tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) > 0 && currentConfig().tlsClientsUser == "cn" {
+		this.certUser = state.PeerCertificates[0].Subject.CommonName
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package core
+
+// stringMatchMaxNesting bounds the recursion on '*', as in redis.
+const stringMatchMaxNesting = 1000
+
+func stringMatch(pattern, str string, noCase bool) bool {
+	skipLongerMatches := false
+	return stringMatchImpl(pattern, str, noCase, &skipLongerMatches, 0)
+}
+
+// stringMatchImpl sets skipLongerMatches once the rest of the pattern after a
+// '*' matches no suffix of str: the '*'s before it can not help by taking
+// more of str, which keeps patterns like a*a*a*b from backtracking
+// exponentially.
+func stringMatchImpl(pattern, str string, noCase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > stringMatchMaxNesting {
+		return false
+	}
+	p, s := 0, 0
+	for p < len(pattern) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for i := s; i <= len(str); i++ {
+				if stringMatchImpl(pattern[p+1:], str[i:], noCase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			if s >= len(str) {
+				return false
+			}
+			s++
+		case '[':
+			if s >= len(str) {
+				return false
+			}
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for p < len(pattern) && pattern[p] != ']' {
+				if pattern[p] == '\\' && p+1 < len(pattern) {
+					p++
+					if equalByte(pattern[p], str[s], noCase) {
+						match = true
+					}
+				} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					if start > end {
+						start, end = end, start
+					}
+					c := str[s]
+					if noCase {
+						start, end, c = toLowerByte(start), toLowerByte(end), toLowerByte(c)
+					}
+					if c >= start && c <= end {
+						match = true
+					}
+					p += 2
+				} else if equalByte(pattern[p], str[s], noCase) {
+					match = true
+				}
+				p++
+			}
+			if p >= len(pattern) {
+				p--
+			}
+			if not {
+				match = !match
+			}
+			if match == false {
+				return false
+			}
+			s++
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+		default:
+			if s >= len(str) || equalByte(pattern[p], str[s], noCase) == false {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	return s == len(str)
+}
+
+func equalByte(a, b byte, noCase bool) bool {
+	if noCase {
+		return toLowerByte(a) == toLowerByte(b)
+	}
+	return a == b
+}
+
+func toLowerByte(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
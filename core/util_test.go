@@ -0,0 +1,43 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		match        bool
+	}{
+		{"*", "", true},
+		{"h?llo", "hello", true},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"*a*", "bab", true},
+		{"a\\*", "a*", true},
+	}
+	for _, item := range cases {
+		if stringMatch(item.pattern, item.str, false) != item.match {
+			t.Errorf("stringMatch(%q, %q) != %v", item.pattern, item.str, item.match)
+		}
+	}
+}
+
+func TestStringMatchBacktracking(t *testing.T) {
+	start := time.Now()
+	if stringMatch("a*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 200), false) {
+		t.Fatal("matched without a b")
+	}
+	if stringMatch(strings.Repeat("*", 3000)+"?"+strings.Repeat("a*", 1500)+"b", strings.Repeat("a", 3000), false) {
+		t.Fatal("matched without a b")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %v", elapsed)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/qiweiyu/redisByGo
+
+go 1.21
@@ -1,17 +1,110 @@
 package main
 
 import (
-	"./service"
+	"flag"
 	"fmt"
-	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/qiweiyu/redisByGo/core"
+	"github.com/qiweiyu/redisByGo/service"
 )
 
 func main() {
-	fmt.Println("Starting Server")
-	listener, err := net.Listen("tcp", "0.0.0.0:5000")
+	if err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "*** FATAL CONFIG FILE ERROR ***", err.Error())
+		os.Exit(1)
+	}
+	if err := core.OpenLog(); err != nil {
+		fmt.Fprintln(os.Stderr, "Can't open the log file:", err.Error())
+		os.Exit(1)
+	}
+	core.LogNotice("Server started, pid=%d", os.Getpid())
+	if err := core.LoadTLS(); err != nil {
+		core.LogWarning("Failed to configure TLS: %s", err.Error())
+		os.Exit(1)
+	}
+	if err := core.LoadACL(); err != nil {
+		core.LogWarning("Error loading the ACL: %s", err.Error())
+		os.Exit(1)
+	}
+	core.InitDatabases()
+	if err := core.LoadData(); err != nil {
+		core.LogWarning("Error loading data: %s", err.Error())
+		os.Exit(1)
+	}
+	listeners, err := service.Listen()
 	if err != nil {
-		fmt.Println("Error listening", err.Error())
-		return
+		core.LogWarning("Error listening: %s", err.Error())
+		os.Exit(1)
+	}
+	if len(listeners) == 0 {
+		core.LogWarning("Error listening: no port or unixsocket configured")
+		os.Exit(1)
+	}
+	core.StartCron()
+	go service.Serve(listeners...)
+	core.LogNotice("Ready to accept connections")
+	code := waitForShutdown()
+	service.Shutdown(listeners...)
+	core.LogNotice("Server is now ready to exit, bye bye...")
+	os.Exit(code)
+}
+
+func waitForShutdown() int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	failed := false
+	for {
+		select {
+		case code := <-core.ShutdownRequested():
+			return code
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				core.ReopenLog()
+				continue
+			}
+			core.LogWarning("Received %s, scheduling shutdown...", sig)
+			err := core.PrepareForShutdown(failed)
+			if err == nil {
+				return 0
+			}
+			if failed {
+				return 1
+			}
+			core.LogWarning("Error trying to shut down the server, send the signal again to force it: %s", err.Error())
+			failed = true
+		}
+	}
+}
+
+func loadConfig() error {
+	var overrides [][2]string
+	configPath := flag.String("config", "", "path to the configuration file")
+	for _, name := range core.ConfigNames() {
+		name := name
+		flag.Func(name, "set the "+name+" config option", func(value string) error {
+			overrides = append(overrides, [2]string{name, value})
+			return nil
+		})
+	}
+	args := os.Args[1:]
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") == false {
+		*configPath = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if *configPath != "" {
+		if err := core.LoadConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	for _, override := range overrides {
+		if err := core.SetConfig(override[0], override[1]); err != nil {
+			return fmt.Errorf("--%s: %s", override[0], err.Error())
+		}
 	}
-	service.Server(listener)
+	return nil
 }
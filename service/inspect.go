@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/qiweiyu/redisByGo/core"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+var ErrWrongType = errors.New("key holds the wrong kind of value")
+
+func (this *Server) manualClock() *core.ManualClock {
+	clock, ok := this.opts.Clock.(*core.ManualClock)
+	if ok == false {
+		panic("service: FastForward and SetTime need Options.Clock to be a *core.ManualClock")
+	}
+	return clock
+}
+
+// FastForward moves the manual clock forward and removes the keys that
+// expired on the way.
+func (this *Server) FastForward(d time.Duration) {
+	this.manualClock().Add(d)
+	core.ExpireKeys()
+}
+
+// SetTime moves the manual clock to the given time and removes the keys that
+// have expired by then.
+func (this *Server) SetTime(t time.Time) {
+	this.manualClock().Set(t)
+	core.ExpireKeys()
+}
+
+// Keys returns every key in the keyspace, sorted. Like the other inspection
+// helpers it looks at database 0.
+func (this *Server) Keys() []string {
+	return core.Keys(0)
+}
+
+func (this *Server) Exists(key string) bool {
+	_, ok := core.InspectKey(0, key)
+	return ok
+}
+
+// Type returns the type name of a key as TYPE would, "none" when it is
+// missing.
+func (this *Server) Type(key string) string {
+	info, ok := core.InspectKey(0, key)
+	if ok == false {
+		return "none"
+	}
+	return info.Type
+}
+
+// TTL returns the time left before a key expires, zero when the key is
+// missing or has no expire.
+func (this *Server) TTL(key string) time.Duration {
+	info, _ := core.InspectKey(0, key)
+	return info.TTL
+}
+
+func (this *Server) inspect(key, keyType string) (core.KeyInfo, error) {
+	info, ok := core.InspectKey(0, key)
+	if ok == false {
+		return info, ErrKeyNotFound
+	}
+	if info.Type != keyType {
+		return info, ErrWrongType
+	}
+	return info, nil
+}
+
+func (this *Server) Get(key string) (string, error) {
+	info, err := this.inspect(key, "string")
+	return info.Str, err
+}
+
+func (this *Server) List(key string) ([]string, error) {
+	info, err := this.inspect(key, "list")
+	return info.List, err
+}
+
+func (this *Server) Hash(key string) (map[string]string, error) {
+	info, err := this.inspect(key, "hash")
+	return info.Hash, err
+}
+
+// Members returns the members of a set, sorted.
+func (this *Server) Members(key string) ([]string, error) {
+	info, err := this.inspect(key, "set")
+	return info.Set, err
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qiweiyu/redisByGo/core"
+)
+
+// Options configures a Server started in process.
+type Options struct {
+	// Addr is the TCP address to listen on, "127.0.0.1:0" picks a free port.
+	// Leave it empty to serve only Dial and Do.
+	Addr string
+	// Config holds config options by name, applied on top of the defaults.
+	Config map[string]string
+	// Clock drives key expiry, the system clock when nil. Pass a
+	// *core.ManualClock to use FastForward and SetTime.
+	Clock core.Clock
+}
+
+// Server runs the whole server inside the current process. The keyspace is
+// process-wide, so only one Server can be started at a time.
+type Server struct {
+	opts      Options
+	listeners []net.Listener
+	sessions  map[*core.Session]bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	started   bool
+	closed    bool
+}
+
+var running atomic.Bool
+
+func NewServer(opts Options) *Server {
+	return &Server{opts: opts, done: make(chan struct{}), sessions: make(map[*core.Session]bool)}
+}
+
+// Start resets the process-wide state, applies the options and starts
+// serving. A Server can only be started once.
+func (this *Server) Start() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.started {
+		return errors.New("server already started")
+	}
+	if running.CompareAndSwap(false, true) == false {
+		return errors.New("another server is already running in this process")
+	}
+	core.Reset()
+	err := this.start()
+	if err != nil {
+		closeListeners(this.listeners)
+		core.Reset()
+		running.Store(false)
+		return err
+	}
+	this.started = true
+	return nil
+}
+
+func (this *Server) start() error {
+	core.SetClock(this.opts.Clock)
+	for name, value := range this.opts.Config {
+		if err := core.SetConfig(name, value); err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+	}
+	core.InitDatabases()
+	if err := core.LoadACL(); err != nil {
+		return err
+	}
+	if this.opts.Addr != "" {
+		listener, err := net.Listen("tcp", this.opts.Addr)
+		if err != nil {
+			return err
+		}
+		this.listeners = append(this.listeners, listener)
+	}
+	core.StartCron()
+	this.wg.Add(2)
+	go func() {
+		defer this.wg.Done()
+		Serve(this.listeners...)
+	}()
+	go func() {
+		defer this.wg.Done()
+		select {
+		case <-core.ShutdownRequested():
+			go this.Close()
+		case <-this.done:
+		}
+	}()
+	return nil
+}
+
+// Addr returns the TCP address the server listens on, or an empty string
+// when it serves in-process connections only.
+func (this *Server) Addr() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(this.listeners) == 0 {
+		return ""
+	}
+	return this.listeners[0].Addr().String()
+}
+
+// Dial opens an in-memory connection speaking RESP, as if a client had
+// connected over the network.
+func (this *Server) Dial() (net.Conn, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.started == false || this.closed {
+		return nil, errors.New("server is not running")
+	}
+	conn, peer := net.Pipe()
+	go core.Handle(peer)
+	return conn, nil
+}
+
+// Do runs a command through a connection of its own and returns the typed
+// reply, so state such as SELECT, MULTI or HELLO does not last between calls;
+// use Dial for that. Error replies are returned both in the reply and as a
+// core.ReplyErr. A blocking command still waiting when ctx is done is
+// cancelled and ctx.Err() returned.
+func (this *Server) Do(ctx context.Context, args ...string) (*core.Reply, error) {
+	this.mu.Lock()
+	if this.started == false || this.closed {
+		this.mu.Unlock()
+		return nil, errors.New("server is not running")
+	}
+	session := core.NewSession()
+	this.sessions[session] = true
+	this.mu.Unlock()
+	defer func() {
+		this.mu.Lock()
+		delete(this.sessions, session)
+		this.mu.Unlock()
+		session.Close()
+	}()
+	reply, err := session.DoContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return reply, reply.Err()
+}
+
+// Close stops the listeners, disconnects every client and waits for them to
+// finish. The keyspace is left as it is until the next Start.
+func (this *Server) Close() error {
+	this.mu.Lock()
+	if this.started == false || this.closed {
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	sessions := make([]*core.Session, 0, len(this.sessions))
+	for session := range this.sessions {
+		sessions = append(sessions, session)
+	}
+	this.mu.Unlock()
+	close(this.done)
+	Shutdown(this.listeners...)
+	for _, session := range sessions {
+		session.Close()
+	}
+	this.wg.Wait()
+	running.Store(false)
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoCancelsBlockingCommand(t *testing.T) {
+	srv := NewServer(Options{})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := srv.Do(ctx, "BLPOP", "list", "0"); errors.Is(err, context.DeadlineExceeded) == false {
+		t.Fatalf("BLPOP: want the context error, got %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := srv.Do(context.Background(), "RPUSH", "list", "a")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do is still waiting on the cancelled BLPOP")
+	}
+	reply, err := srv.Do(context.Background(), "LLEN", "list")
+	if n, _ := reply.Integer(); err != nil || n != 1 {
+		t.Fatalf("LLEN: %d %v", n, err)
+	}
+}
+
+func TestDoCallsRunConcurrently(t *testing.T) {
+	srv := NewServer(Options{})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	popped := make(chan []string, 1)
+	go func() {
+		reply, _ := srv.Do(context.Background(), "BLPOP", "list", "0")
+		list, _ := reply.Strings()
+		popped <- list
+	}()
+	if _, err := srv.Do(context.Background(), "SELECT", "1"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		reply, err := srv.Do(context.Background(), "INFO", "clients")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := reply.Text(); strings.Contains(info, "blocked_clients:1") {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := srv.Do(context.Background(), "RPUSH", "list", "a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case list := <-popped:
+		if strings.Join(list, ",") != "list,a" {
+			t.Fatalf("BLPOP: %v", list)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("BLPOP was not served")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := srv.Do(ctx, "SET", "key", "value"); errors.Is(err, context.Canceled) == false {
+		t.Fatalf("SET with a done context: %v", err)
+	}
+	if reply, _ := srv.Do(context.Background(), "EXISTS", "key"); reply.Int != 0 {
+		t.Fatal("SET ran with a done context")
+	}
+}
@@ -1,11 +1,72 @@
 package service
 
 import (
-	"../core"
+	"crypto/tls"
 	"net"
+	"os"
+	"sync"
+
+	"github.com/qiweiyu/redisByGo/core"
 )
 
-func Server(listener net.Listener) {
+func Listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range core.ListenAddrs() {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range core.TLSListenAddrs() {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, tls.NewListener(listener, core.TLSConfig()))
+	}
+	if path, perm := core.UnixSocket(); path != "" {
+		os.Remove(path)
+		listener, err := net.Listen("unix", path)
+		if err == nil && perm != 0 {
+			err = os.Chmod(path, perm)
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+func Serve(listeners ...net.Listener) {
+	var wg sync.WaitGroup
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener net.Listener) {
+			defer wg.Done()
+			serve(listener)
+		}(listener)
+	}
+	wg.Wait()
+}
+
+func Shutdown(listeners ...net.Listener) {
+	closeListeners(listeners)
+	core.StopCron()
+	core.CloseClients()
+}
+
+func serve(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {